@@ -8,16 +8,31 @@ package clog
 import (
 	"fmt"
 	"os"
+	"sync"
 )
 
+// Conversions can run in parallel, so each message is written whole under the lock to
+// keep lines from interleaving.
+var mutex sync.Mutex
+
+func write(message string) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	os.Stderr.WriteString(message)
+}
+
 func Infoln(a ...any) {
-	fmt.Fprintln(os.Stderr, append([]any{"INFO"}, a...)...)
+	write(fmt.Sprintln(append([]any{"INFO"}, a...)...))
 }
 
 func Errorln(a ...any) {
-	fmt.Fprintln(os.Stderr, append([]any{"ERR "}, a...)...)
+	write(fmt.Sprintln(append([]any{"ERR "}, a...)...))
 }
 
 func Errorf(format string, a ...any) {
-	fmt.Fprintf(os.Stderr, "ERR "+format, a...)
+	write(fmt.Sprintf("ERR "+format, a...))
+}
+
+func Infof(format string, a ...any) {
+	write(fmt.Sprintf("INFO "+format, a...))
 }
@@ -4,8 +4,12 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
 	"runtime/debug"
 	"strings"
+	"time"
 
 	"go.mukunda.com/pmage/clog"
 	"go.mukunda.com/pmage/pmage"
@@ -15,17 +19,170 @@ var VERSION = "0.1"
 
 var usageText = strings.TrimSpace(`
 Usage: pmage [options] inputpath outputpath
+       pmage build [options] [inputs... | --project FILE] [--out DIR]
+       pmage watch [options] [inputs... | --project FILE] [--out DIR]
+       pmage decode [options] datapath output.png
+       pmage info [options] inputpath
 Use --help for more info.`)
 
 var helpText = strings.TrimSpace(`
 Usage: pmage [options] inputpath outputpath
+       pmage build [options] [inputs... | --project FILE] [--out DIR]
+       pmage watch [options] [inputs... | --project FILE] [--out DIR]
+       pmage decode [options] datapath output.png
+       pmage info [options] inputpath
+
+A _defaults.yaml or pmage.defaults.yaml file gives default options for the pmage files
+in its directory and below. Options in pmage files override the defaults, and defaults
+closer to the image override ones further up. Images that a defaults file applies to
+don't need their own pmage file. The search for defaults files stops at a directory
+with a pmage.yaml project file, or at a defaults file with "root: true".
+
+The build command converts many images in one run. Inputs are PNG files, directories,
+which are searched recursively, or glob patterns. Only images with a pmage file next to
+them, or a defaults file that applies to them, are converted. Images that are written
+by another conversion, like previews, are skipped. A summary is printed at the end, and
+the exit code is 1 if any conversion failed.
+
+Without inputs, build converts the images listed in the project file, pmage.yaml in the
+current directory. A project file has groups of inputs with shared options, e.g.:
+
+  profile: snes
+  out: build/gfx
+  export_types: ca65
+  compression: lz77
+  groups:
+    - inputs: [gfx/sprites]
+      segment: SPRITES
+      assets:
+        gfx/sprites/hero.png: {compression: none}
+    - inputs: gfx/fonts/*.png
+      out: build/fonts
+      export_types: [c, json]
+
+Any pmage file option can be given at the top level, in a group, or for an asset. The
+profile can only be given at the top level. Images in a project don't need pmage files.
+Defaults files and pmage files override the project. Paths are relative to the project
+file. Changing the project file rebuilds its images.
+
+The watch command does the same as build, and then keeps checking the inputs for new
+images and changes to images and pmage files, converting only the affected images. It
+prints a line for each conversion. Stop it with Ctrl+C.
 
 Options:
 --profile PROFILE, -p PROFILE
   Select device profile. Can be "snes".
 
---export TYPE, -e TYPE
-  Select export type. Can be "ca65".
+--export TYPES, -e TYPES
+  Select export types, separated by commas. Can be "ca65", "wla", "asar", "c", "bin",
+  "bin-asar", "bin-wla", "preview" or "json". The first export is written to the
+  output path and the others next to it with the extension of their type, e.g.
+  "-e ca65,preview" writes font.asm and font.png. Pmage files can list more exports
+  in the "outputs" field. Defaults to ca65 when no exports are given.
+  The "ca65" export also writes an include with .global declarations and size
+  constants next to the output path, with a .inc extension, or .global.inc if the
+  output path already ends in .inc. It's listed with the outputs, e.g. in dependency
+  files, and no other export may write to the same path.
+  The "c" export writes a .c file to the output path and a .h file next to it.
+  The "bin" export writes raw .chr, .pal and .map files next to the output path. If
+  the output path ends in .inc, .asm or .s, a ca65 include for them is written there,
+  or a C header with their sizes for .h. "bin-asar" and "bin-wla" do the same with an
+  asar or WLA-DX include.
+  The "preview" export writes a PNG of the converted image, tileset and palette.
+  The "json" export writes a manifest with the dimensions, palette, map, labels, sizes
+  and compression of the converted data, for other tools to read.
+
+--labels TEMPLATE
+  Default symbol name template, e.g. "gfx{Name}{Section}". {name} is the asset name
+  and {section} is what the symbol is for, like "pixels" or "num_tiles". {Name} and
+  {NAME} insert them in PascalCase and UPPER_CASE. Defaults to "{name}_{section}".
+  Pmage files can override this with the "labels" field.
+
+--label-prefix PREFIX, --label-suffix SUFFIX
+  Text to add before or after every symbol name.
+
+--label-case STYLE
+  Case style for symbol names. Can be "snake", "camel", "pascal" or "upper".
+
+--set KEY=VALUE
+  Override a pmage file option, e.g. "--set bpp=2" or "--set tiles=16x16". Can be
+  given more than once. Values are YAML, e.g. "--set outputs=[ca65,json]", and nested
+  options are set with dots, e.g. "--set compression.map=lz2". A single image converted
+  with --set or --config doesn't need a pmage file.
+
+--config FILE
+  Override pmage file options with the ones in FILE. Can be given more than once.
+  --set and --config options are applied in order, on top of the pmage file.
+
+-MD
+  Write a make dependency file next to the output path, with a .d extension. It lists
+  the image and pmage files as dependencies of the outputs.
+
+-MF PATH
+  Write the dependency file to PATH instead. Implies -MD. Not available for build.
+
+Build and watch options:
+--project FILE
+  Build the images in a project file other than pmage.yaml.
+
+--out DIR, -o DIR
+  Write outputs to DIR, keeping the layout of searched directories. Outputs are named
+  after the image with the extension of the first export type. By default, they're
+  written next to the images. Not available with a project file, which has its own.
+
+--jobs N, -j N
+  Number of images to convert at the same time. Defaults to the number of CPUs.
+  Results are reported in the order of the inputs.
+
+--cache-dir DIR
+  Where to keep the build cache. Defaults to .pmage-cache in the current directory.
+  Images are skipped if they, their pmage files, the options and the pmage version
+  haven't changed since the last build, and the outputs still exist.
+
+--no-cache
+  Convert every image, ignoring the cache.
+
+Watch options:
+--interval DURATION
+  How often to check for changes, e.g. "250ms" or "2s". Defaults to 500ms.
+
+The decode command does the reverse of a conversion. It reads raw pixel data, like
+a .chr file or a part of a ROM, and renders it to a PNG so it can be inspected.
+
+Decode options:
+--bpp N
+  Bits per pixel of the data. Defaults to the profile's, which is 4 for SNES.
+
+--tiles SIZE
+  Tile size, e.g. "8x8" or "16". Defaults to 8x8. Use 1x1 tiles and --tiles-per-row
+  for untiled linear data.
+
+--tiles-per-row N
+  Number of tiles in each row of the image. Defaults to 16.
+
+--packing PACKING
+  How pixels are packed into bytes. Can be "snes", which stores each 8x8 tile as
+  bitplanes like the SNES PPU, or "linear". Defaults to the profile's. With "snes",
+  the tile size must be a multiple of 8x8, and larger tiles are read as 8x8 tiles from
+  left to right and top to bottom, the way the converter writes them.
+
+--compression SCHEME
+  Compression of the data. Can be "none", "lz77" or "lz2". Defaults to none.
+
+--offset N, --size N
+  Where the data starts in the file and how many bytes to read, e.g. "0x8000". By
+  default, the whole file is read. With compression, the size can be left out.
+
+--palette FILE, --palette-offset N
+  Read the palette from FILE, starting at the offset, in the profile's color format.
+  Without a palette, a grayscale ramp is used.
+
+The info command converts an image without writing anything, and prints a report: the
+resolved options and the files they came from, the number of colors before and after
+converting to the profile's color format, the palette with the source color of each
+entry, the number of tiles and unique tiles, and the size of each output section with
+and without compression. The exit code is 1 if the image can't be converted. It takes
+the profile, label, --set and --config options.
 `)
 
 type Config struct {
@@ -35,6 +192,35 @@ type Config struct {
 	Help           bool
 	ExportType     string
 	Version        bool
+	Labels         string
+	LabelPrefix    string
+	LabelSuffix    string
+	LabelCase      string
+	DepFile        bool
+	DepFilePath    string
+	Overrides      []pmage.OptionLayer // From --set and --config.
+
+	// For the build command.
+	Inputs      []string
+	ProjectPath string
+	OutputDir   string
+	Jobs        int
+	CacheDir    string
+	NoCache     bool
+
+	// For the watch command.
+	Interval time.Duration
+
+	// For the decode command.
+	Bpp           int
+	Tiles         string
+	TilesPerRow   int
+	Packing       string
+	Compression   string
+	Offset        int
+	Size          int
+	PalettePath   string
+	PaletteOffset int
 }
 
 func getBuildCommit() string {
@@ -57,19 +243,125 @@ func printVersion() {
 	}
 }
 
-func pmageCli(args []string) int {
+// Collects --set and --config options in the order they're given, so later ones win.
+type overridesFlag struct {
+	overrides *[]pmage.OptionLayer
+	isFile    bool
+}
 
-	flags := flag.NewFlagSet("pmage", flag.ExitOnError)
+func (f overridesFlag) String() string {
+	return ""
+}
 
-	var config Config
-	flags.StringVar(&config.Profile, "export", "", "Select export type [ca65]")
-	flags.StringVar(&config.Profile, "e", "", "Select export type [ca65]")
+func (f overridesFlag) Set(value string) error {
+	if f.isFile {
+		*f.overrides = append(*f.overrides, pmage.OptionLayer{Source: value})
+		return nil
+	}
+	layer, err := pmage.ParseOptionOverride(value)
+	if err != nil {
+		return err
+	}
+	*f.overrides = append(*f.overrides, layer)
+	return nil
+}
+
+// Options shared by the commands.
+func addFlags(flags *flag.FlagSet, config *Config) {
+	flags.StringVar(&config.ExportType, "export", "", "Select export types [ca65, wla, asar, c, bin, bin-asar, bin-wla, preview, json]")
+	flags.StringVar(&config.ExportType, "e", "", "Select export types [ca65, wla, asar, c, bin, bin-asar, bin-wla, preview, json]")
 	flags.StringVar(&config.Profile, "profile", "", "Select device profile")
 	flags.StringVar(&config.Profile, "p", "", "Select device profile")
 	flags.BoolVar(&config.Help, "help", false, "Show help")
 	flags.BoolVar(&config.Help, "h", false, "Show help")
 	flags.BoolVar(&config.Help, "?", false, "Show help")
 	flags.BoolVar(&config.Version, "version", false, "Show version")
+	flags.StringVar(&config.Labels, "labels", "", "Symbol name template")
+	flags.StringVar(&config.LabelPrefix, "label-prefix", "", "Prefix for symbol names")
+	flags.StringVar(&config.LabelSuffix, "label-suffix", "", "Suffix for symbol names")
+	flags.StringVar(&config.LabelCase, "label-case", "", "Case style for symbol names [snake, camel, pascal, upper]")
+	flags.BoolVar(&config.DepFile, "MD", false, "Write a make dependency file")
+	flags.StringVar(&config.DepFilePath, "MF", "", "Path for the dependency file")
+	flags.Var(overridesFlag{&config.Overrides, false}, "set", "Override a pmage file option, as key=value")
+	flags.Var(overridesFlag{&config.Overrides, true}, "config", "Override pmage file options from a YAML file")
+}
+
+// Parses flags that may come after the positional arguments, e.g. "build src --out dir".
+func parseInterspersed(flags *flag.FlagSet, args []string) []string {
+	positional := []string{}
+	for {
+		flags.Parse(args)
+		args = flags.Args()
+		if len(args) == 0 {
+			return positional
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func createProfile(config *Config) (*pmage.Profile, error) {
+	var p pmage.Profile
+	config.Profile = strings.ToLower(config.Profile)
+	switch config.Profile {
+	case "":
+		clog.Infoln("Defaulting to SNES profile.")
+		p.System = "snes"
+	case "snes": // Add valid profiles here.
+		p.System = config.Profile
+	default:
+		return nil, fmt.Errorf("Unknown profile: %s", config.Profile)
+	}
+
+	labelCase, err := pmage.ParseLabelCase(config.LabelCase)
+	if err != nil {
+		return nil, err
+	}
+	p.Labels = pmage.LabelOptions{
+		Template: config.Labels,
+		Prefix:   config.LabelPrefix,
+		Suffix:   config.LabelSuffix,
+		Case:     labelCase,
+	}
+	if err = p.Labels.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+func parseExportTypes(exportType string) []string {
+	exportTypes := []string{}
+	for _, exportType := range strings.Split(exportType, ",") {
+		if exportType = strings.TrimSpace(exportType); exportType != "" {
+			exportTypes = append(exportTypes, strings.ToLower(exportType))
+		}
+	}
+	return exportTypes
+}
+
+func depFilePathFor(outputPath string) string {
+	return strings.TrimSuffix(outputPath, filepath.Ext(outputPath)) + ".d"
+}
+
+func pmageCli(args []string) int {
+	if len(args) > 0 && args[0] == "build" {
+		return buildCli(args[1:])
+	}
+	if len(args) > 0 && args[0] == "watch" {
+		return watchCli(args[1:])
+	}
+	if len(args) > 0 && args[0] == "decode" {
+		return decodeCli(args[1:])
+	}
+	if len(args) > 0 && args[0] == "info" {
+		return infoCli(args[1:])
+	}
+
+	flags := flag.NewFlagSet("pmage", flag.ExitOnError)
+
+	var config Config
+	addFlags(flags, &config)
 	flags.Parse(args)
 
 	if config.Help {
@@ -97,31 +389,367 @@ func pmageCli(args []string) int {
 		return 1
 	}
 
-	var p pmage.Profile
-	config.Profile = strings.ToLower(config.Profile)
-	switch config.Profile {
-	case "":
-		clog.Infoln("Defaulting to SNES profile.")
-		p.System = "snes"
-	case "snes": // Add valid profiles here.
-		p.System = config.Profile
-	default:
-		clog.Errorf("Unknown profile: %s\n", config.Profile)
+	p, err := createProfile(&config)
+	if err != nil {
+		clog.Errorln(err)
+		return 1
+	}
+
+	converter := pmage.NewConverter(p)
+	result, err := converter.Convert(pmage.ConvertJob{
+		InputPath:   config.InputFilePath,
+		OutputPath:  config.OutputFilePath,
+		ExportTypes: parseExportTypes(config.ExportType),
+		Overrides:   config.Overrides,
+	})
+	if err != nil {
+		clog.Errorln(err)
+		return 1
+	}
+
+	if config.DepFile || config.DepFilePath != "" {
+		depFilePath := config.DepFilePath
+		if depFilePath == "" {
+			depFilePath = depFilePathFor(config.OutputFilePath)
+		}
+		if err = pmage.WriteDepFileToPath(depFilePath, result); err != nil {
+			clog.Errorln(err)
+			return 1
+		}
+	}
+
+	return 0
+}
+
+// Parses the options for build and watch, and creates the converter for them. Returns
+// an exit code if the command shouldn't continue.
+func setupBatch(name string, args []string) (*Config, pmage.Converter, int, bool) {
+	flags := flag.NewFlagSet("pmage "+name, flag.ExitOnError)
+
+	var config Config
+	addFlags(flags, &config)
+	flags.StringVar(&config.ProjectPath, "project", "", "Project file")
+	flags.StringVar(&config.OutputDir, "out", "", "Output directory")
+	flags.StringVar(&config.OutputDir, "o", "", "Output directory")
+	flags.IntVar(&config.Jobs, "jobs", runtime.GOMAXPROCS(0), "Number of parallel conversions")
+	flags.IntVar(&config.Jobs, "j", runtime.GOMAXPROCS(0), "Number of parallel conversions")
+	flags.StringVar(&config.CacheDir, "cache-dir", ".pmage-cache", "Build cache directory")
+	flags.BoolVar(&config.NoCache, "no-cache", false, "Ignore the build cache")
+	if name == "watch" {
+		flags.DurationVar(&config.Interval, "interval", 500*time.Millisecond, "How often to check for changes")
+	}
+	config.Inputs = parseInterspersed(flags, args)
+
+	if config.Help {
+		fmt.Println(helpText)
+		return nil, nil, 0, false
+	}
+
+	if config.Jobs < 1 {
+		clog.Errorln("The number of jobs must be at least 1.")
+		return nil, nil, 1, false
+	}
+
+	if name == "watch" && config.Interval <= 0 {
+		clog.Errorln("The interval must be more than 0.")
+		return nil, nil, 1, false
+	}
+
+	if len(config.Inputs) > 0 && config.ProjectPath != "" {
+		clog.Errorln("Inputs can't be used with --project.")
+		return nil, nil, 1, false
+	}
+
+	if len(config.Inputs) == 0 && config.ProjectPath == "" {
+		if _, err := os.Stat(pmage.DefaultProjectFile); err != nil {
+			clog.Errorf("No inputs specified, and there's no %s.\n", pmage.DefaultProjectFile)
+			clog.Errorln(usageText)
+			return nil, nil, 1, false
+		}
+		config.ProjectPath = pmage.DefaultProjectFile
+	}
+
+	if config.ProjectPath != "" {
+		if config.OutputDir != "" {
+			clog.Errorln("--out can't be used with a project file. Set \"out\" in the project instead.")
+			return nil, nil, 1, false
+		}
+		project, err := pmage.LoadProject(config.ProjectPath)
+		if err != nil {
+			clog.Errorln(err)
+			return nil, nil, 1, false
+		}
+		if config.Profile == "" {
+			config.Profile = project.Profile
+		}
+	}
+
+	if config.DepFilePath != "" {
+		clog.Errorf("-MF can't be used with %s. Use -MD to write a .d file for each output.\n", name)
+		return nil, nil, 1, false
+	}
+
+	p, err := createProfile(&config)
+	if err != nil {
+		clog.Errorln(err)
+		return nil, nil, 1, false
+	}
+
+	converter := pmage.NewConverter(p)
+	if !config.NoCache {
+		cache := &pmage.BuildCache{Dir: config.CacheDir, Version: VERSION + " " + getBuildCommit()}
+		converter = pmage.NewCachedConverter(converter, p, cache)
+	}
+
+	return &config, converter, 0, true
+}
+
+// Finds the jobs in the inputs or the project file.
+func findBatchJobs(config *Config, converter pmage.Converter) ([]pmage.ConvertJob, error) {
+	exportTypes := parseExportTypes(config.ExportType)
+	var jobs []pmage.ConvertJob
+	var err error
+	if config.ProjectPath == "" {
+		jobs, err = pmage.FindJobs(converter, config.Inputs, config.OutputDir, exportTypes)
+	} else {
+		var project *pmage.Project
+		if project, err = pmage.LoadProject(config.ProjectPath); err == nil {
+			jobs, err = project.Jobs(converter, exportTypes)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range jobs {
+		jobs[i].Overrides = config.Overrides
+	}
+	return jobs, nil
+}
+
+// Writes the dependency file for a finished job if requested. Returns the job's error.
+func finishJob(config *Config, result pmage.JobResult) error {
+	if result.Err == nil && config.DepFile {
+		return pmage.WriteDepFileToPath(depFilePathFor(result.Job.OutputPath), result.Result)
+	}
+	return result.Err
+}
+
+func buildCli(args []string) int {
+	config, converter, code, ok := setupBatch("build", args)
+	if !ok {
+		return code
+	}
+
+	jobs, err := findBatchJobs(config, converter)
+	if err != nil {
+		clog.Errorln(err)
 		return 1
 	}
 
-	if config.ExportType == "" {
-		clog.Infoln("Defaulting to ca65 export.")
-		config.ExportType = "ca65"
+	failed, upToDate := 0, 0
+	for _, result := range pmage.RunJobs(converter, jobs, config.Jobs) {
+		if err := finishJob(config, result); err != nil {
+			clog.Errorf("%s: %v\n", result.Job.InputPath, err)
+			failed++
+		} else if result.Result.Cached {
+			upToDate++
+		}
 	}
 
-	converter := pmage.NewConverter(&p)
-	err := converter.Convert(config.InputFilePath, config.OutputFilePath, strings.ToLower(config.ExportType))
+	clog.Infof("Converted %d of %d images, %d up to date, %d failed.\n",
+		len(jobs)-failed-upToDate, len(jobs), upToDate, failed)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+func watchCli(args []string) int {
+	config, converter, code, ok := setupBatch("watch", args)
+	if !ok {
+		return code
+	}
+
+	// The inputs are searched again on each poll. While that fails, e.g. because the
+	// project is broken, the last jobs that were found are watched.
+	watcher := &pmage.Watcher{
+		Converter: converter,
+		Workers:   config.Jobs,
+		FindJobs: func() ([]pmage.ConvertJob, error) {
+			return findBatchJobs(config, converter)
+		},
+		OnError: func(err error) {
+			clog.Errorln(err)
+		},
+		OnResult: func(result pmage.JobResult) {
+			if err := finishJob(config, result); err != nil {
+				clog.Errorf("%s: %v\n", result.Job.InputPath, err)
+			} else if !result.Result.Cached {
+				clog.Infof("%s -> %s (%dms)\n", result.Job.InputPath, result.Job.OutputPath,
+					result.Duration.Milliseconds())
+			}
+		},
+	}
+
+	watching := strings.Join(config.Inputs, ", ")
+	if config.ProjectPath != "" {
+		watching = config.ProjectPath
+	}
+	clog.Infof("Watching %s. Press Ctrl+C to stop.\n", watching)
+	stop := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	go func() {
+		<-signals
+		close(stop)
+	}()
+
+	if err := watcher.Run(config.Interval, stop); err != nil {
+		clog.Errorln(err)
+		return 1
+	}
+	return 0
+}
+
+// Reads size bytes from the file at the offset, or the rest of the file if size is 0.
+func readFileRange(path string, offset int, size int) ([]byte, error) {
+	data, err := os.ReadFile(path)
 	if err != nil {
+		return nil, err
+	}
+	if offset < 0 || offset > len(data) || size < 0 || offset+size > len(data) {
+		return nil, fmt.Errorf("%s: offset %d and size %d are outside of the file (%d bytes)",
+			path, offset, size, len(data))
+	}
+	if size == 0 {
+		return data[offset:], nil
+	}
+	return data[offset : offset+size], nil
+}
+
+func decodeCli(args []string) int {
+	flags := flag.NewFlagSet("pmage decode", flag.ExitOnError)
+
+	var config Config
+	flags.StringVar(&config.Profile, "profile", "", "Select device profile")
+	flags.StringVar(&config.Profile, "p", "", "Select device profile")
+	flags.BoolVar(&config.Help, "help", false, "Show help")
+	flags.BoolVar(&config.Help, "h", false, "Show help")
+	flags.IntVar(&config.Bpp, "bpp", 0, "Bits per pixel")
+	flags.StringVar(&config.Tiles, "tiles", "8x8", "Tile size")
+	flags.IntVar(&config.TilesPerRow, "tiles-per-row", pmage.DefaultDecodeTilesPerRow, "Tiles in each row")
+	flags.StringVar(&config.Packing, "packing", "", "Pixel packing [snes, linear]")
+	flags.StringVar(&config.Compression, "compression", "", "Compression of the data [none, lz77, lz2]")
+	flags.IntVar(&config.Offset, "offset", 0, "Where the data starts in the file")
+	flags.IntVar(&config.Size, "size", 0, "Number of bytes to read")
+	flags.StringVar(&config.PalettePath, "palette", "", "Palette file")
+	flags.IntVar(&config.PaletteOffset, "palette-offset", 0, "Where the palette starts in the file")
+	positional := parseInterspersed(flags, args)
+
+	if config.Help {
+		fmt.Println(helpText)
+		return 0
+	}
+
+	if len(positional) < 2 {
+		clog.Errorln("No data path or output path specified.")
+		clog.Errorln(usageText)
+		return 1
+	}
+	config.InputFilePath, config.OutputFilePath = positional[0], positional[1]
+
+	p, err := createProfile(&config)
+	if err != nil {
+		clog.Errorln(err)
+		return 1
+	}
+
+	options := pmage.DecodeOptions{Bpp: int16(config.Bpp), TilesPerRow: config.TilesPerRow}
+	if options.Bpp == 0 {
+		options.Bpp = p.DefaultBpp()
+	}
+	if options.TileWidth, options.TileHeight, err = pmage.ParseTileSize(config.Tiles); err != nil {
+		clog.Errorln(err)
+		return 1
+	}
+	if options.Packing, err = pmage.ParsePixelPacking(config.Packing); err != nil {
+		clog.Errorln(err)
+		return 1
+	}
+	if options.Compression, err = pmage.ParsePixelCompression(config.Compression); err != nil {
+		clog.Errorln(err)
+		return 1
+	}
+
+	data, err := readFileRange(config.InputFilePath, config.Offset, config.Size)
+	if err != nil {
+		clog.Errorln(err)
+		return 1
+	}
+
+	if config.PalettePath != "" {
+		paletteData, err := readFileRange(config.PalettePath, config.PaletteOffset, 0)
+		if err != nil {
+			clog.Errorln(err)
+			return 1
+		}
+		if options.Palette, err = pmage.UnpackPalette(paletteData, p.GetColorFormat()); err != nil {
+			clog.Errorln(err)
+			return 1
+		}
+		if options.Bpp <= 8 && len(options.Palette) > 1<<options.Bpp {
+			options.Palette = options.Palette[:1<<options.Bpp]
+		}
+	}
+
+	if err = pmage.DecodeToPng(p, data, options, config.OutputFilePath); err != nil {
 		clog.Errorln(err)
 		return 1
 	}
+	return 0
+}
+
+func infoCli(args []string) int {
+	flags := flag.NewFlagSet("pmage info", flag.ExitOnError)
+
+	var config Config
+	addFlags(flags, &config)
+	positional := parseInterspersed(flags, args)
+
+	if config.Help {
+		fmt.Println(helpText)
+		return 0
+	}
 
+	if len(positional) < 1 {
+		clog.Errorln("No input file path specified.")
+		clog.Errorln(usageText)
+		return 1
+	}
+	config.InputFilePath = positional[0]
+
+	p, err := createProfile(&config)
+	if err != nil {
+		clog.Errorln(err)
+		return 1
+	}
+
+	report, err := pmage.Inspect(p, pmage.ConvertJob{
+		InputPath: config.InputFilePath,
+		Overrides: config.Overrides,
+	})
+	if err != nil {
+		clog.Errorln(err)
+		return 1
+	}
+	if err = report.Write(os.Stdout); err != nil {
+		clog.Errorln(err)
+		return 1
+	}
+	if report.Err != nil {
+		return 1
+	}
 	return 0
 }
 
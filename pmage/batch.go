@@ -0,0 +1,279 @@
+package pmage
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The outcome of a job. Result is nil if it failed.
+type JobResult struct {
+	Job      ConvertJob
+	Result   *ConvertResult
+	Err      error
+	Duration time.Duration
+}
+
+var ErrNoInputs = errors.New("no inputs found")
+
+// Images are only converted in batches if they have a pmage file, or a defaults file
+// applies to them.
+func hasPmageFile(imagePath string) bool {
+	yamlPath := changeExt(imagePath, ".yaml")
+	if info, err := os.Stat(yamlPath); err == nil && !info.IsDir() {
+		return true
+	}
+	defaults, _, err := findDefaultsFiles(yamlPath)
+	return err == nil && len(defaults) > 0
+}
+
+func isPng(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".png")
+}
+
+// An image found by findImages, with the directory that was searched to find it.
+type foundImage struct {
+	root string
+	path string
+}
+
+// Searches the inputs for PNG files. Inputs are PNG files, directories, which are
+// searched recursively, or glob patterns. If requirePmageFile is set, images without a
+// pmage file next to them are skipped.
+func findImages(inputs []string, requirePmageFile bool) ([]foundImage, error) {
+	images := []foundImage{}
+	seen := map[string]bool{}
+	addImage := func(root string, imagePath string) {
+		if seen[imagePath] || !isPng(imagePath) || (requirePmageFile && !hasPmageFile(imagePath)) {
+			return
+		}
+		seen[imagePath] = true
+		images = append(images, foundImage{root, imagePath})
+	}
+
+	for _, input := range inputs {
+		matches, err := filepath.Glob(input)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("%w: %s", ErrNoInputs, input)
+		}
+		sort.Strings(matches)
+
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil {
+				return nil, err
+			}
+			if !info.IsDir() {
+				addImage(filepath.Dir(match), match)
+				continue
+			}
+
+			err = filepath.WalkDir(match, func(path string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if !d.IsDir() {
+					addImage(match, path)
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return images, nil
+}
+
+// The extension of the main output, from the first export type.
+func outputExt(exportTypes []string) (string, error) {
+	if len(exportTypes) == 0 {
+		return ".asm", nil
+	}
+	t := findExportType(exportTypes[0])
+	if t == nil {
+		return "", fmt.Errorf("Unknown export type \"%s\". Valid export types are [%s]",
+			exportTypes[0], exportTypeNames())
+	}
+	return t.ext, nil
+}
+
+// Where the output of a found image goes. If outDir is empty, it's next to the image.
+func (image foundImage) outputPath(outDir string, ext string) string {
+	if outDir == "" {
+		return changeExt(image.path, ext)
+	}
+	rel, err := filepath.Rel(image.root, image.path)
+	if err != nil {
+		rel = filepath.Base(image.path)
+	}
+	return changeExt(filepath.Join(outDir, rel), ext)
+}
+
+// Finds the images to convert and where their output goes. Inputs are PNG files,
+// directories, which are searched recursively, or glob patterns. Only images with a
+// pmage file next to them, or a defaults file that applies to them, are converted.
+//
+// Outputs are written to outDir, keeping the layout of the files under a searched
+// directory, and named after the image with the extension of the first export type. If
+// outDir is empty, outputs are written next to the images. Images written by another
+// job, like previews, are skipped. It's an error for two images to write the same file.
+func FindJobs(converter Converter, inputs []string, outDir string, exportTypes []string) ([]ConvertJob, error) {
+	ext, err := outputExt(exportTypes)
+	if err != nil {
+		return nil, err
+	}
+	images, err := findImages(inputs, true)
+	if err != nil {
+		return nil, err
+	}
+	if len(images) == 0 {
+		return nil, fmt.Errorf("%w: no PNG files with pmage or defaults files in %s", ErrNoInputs, strings.Join(inputs, ", "))
+	}
+
+	jobs := []ConvertJob{}
+	for _, image := range images {
+		jobs = append(jobs, ConvertJob{
+			InputPath:   image.path,
+			OutputPath:  image.outputPath(outDir, ext),
+			ExportTypes: exportTypes,
+		})
+	}
+	jobs, files := removeOutputJobs(jobs, planJobs(converter, jobs))
+	if err = checkOutputPaths(jobs, files); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// Finds the files each job writes. A job that can't be planned, e.g. because its pmage
+// file is invalid, fails when it's run, so only the outputs of its export types are used.
+func planJobs(converter Converter, jobs []ConvertJob) [][]string {
+	files := make([][]string, len(jobs))
+	for i, job := range jobs {
+		planned, err := converter.Plan(job)
+		if err != nil {
+			planned = []string{job.OutputPath}
+			if outputs, err := resolveOutputs(job.OutputPath, job.ExportTypes, nil, []string{job.InputPath}); err == nil {
+				planned = nil
+				for _, output := range outputs {
+					planned = append(planned, output.Path)
+				}
+			}
+		}
+		files[i] = planned
+	}
+	return files
+}
+
+// Drops the jobs for images that another job writes, like a preview next to its image,
+// so a batch doesn't convert its own outputs on the next run.
+func removeOutputJobs(jobs []ConvertJob, files [][]string) ([]ConvertJob, [][]string) {
+	writers := map[string]string{}
+	for i, job := range jobs {
+		for _, file := range files[i] {
+			writers[filepath.Clean(file)] = job.InputPath
+		}
+	}
+
+	keptJobs, keptFiles := []ConvertJob{}, [][]string{}
+	for i, job := range jobs {
+		if writer, ok := writers[filepath.Clean(job.InputPath)]; ok && writer != job.InputPath {
+			continue
+		}
+		keptJobs = append(keptJobs, job)
+		keptFiles = append(keptFiles, files[i])
+	}
+	return keptJobs, keptFiles
+}
+
+// Returns an error for each job that writes a file an earlier job also writes, which
+// happens when images in different searched directories have the same name, or nil if
+// there's no such file.
+func outputConflicts(jobs []ConvertJob, files [][]string) []error {
+	conflicts := make([]error, len(jobs))
+	writers := map[string]string{}
+	for i, job := range jobs {
+		for _, file := range files[i] {
+			if other, ok := writers[filepath.Clean(file)]; ok {
+				conflicts[i] = fmt.Errorf("%w: %s and %s are both written to %s",
+					ErrInvalidOutput, other, job.InputPath, file)
+				break
+			}
+		}
+		if conflicts[i] != nil {
+			continue
+		}
+		for _, file := range files[i] {
+			writers[filepath.Clean(file)] = job.InputPath
+		}
+	}
+	return conflicts
+}
+
+// Returns an error if two jobs write the same file.
+func checkOutputPaths(jobs []ConvertJob, files [][]string) error {
+	for _, err := range outputConflicts(jobs, files) {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Runs a job, creating the output directory if needed.
+func RunJob(converter Converter, job ConvertJob) JobResult {
+	start := time.Now()
+	if err := os.MkdirAll(filepath.Dir(job.OutputPath), 0755); err != nil {
+		return JobResult{Job: job, Err: err}
+	}
+	result, err := converter.Convert(job)
+	return JobResult{Job: job, Result: result, Err: err, Duration: time.Since(start)}
+}
+
+// Runs the jobs on a pool of workers. The results are in the same order as the jobs,
+// regardless of which finish first. Failed jobs don't stop the batch. A job that writes
+// a file an earlier one also writes fails without running, so two workers never write
+// the same files.
+func RunJobs(converter Converter, jobs []ConvertJob, workers int) []JobResult {
+	workers = max(min(workers, len(jobs)), 1)
+	results := make([]JobResult, len(jobs))
+
+	run := []int{}
+	for i, err := range outputConflicts(jobs, planJobs(converter, jobs)) {
+		if err != nil {
+			results[i] = JobResult{Job: jobs[i], Err: err}
+			continue
+		}
+		run = append(run, i)
+	}
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				results[i] = RunJob(converter, jobs[i])
+			}
+		}()
+	}
+
+	for _, i := range run {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	return results
+}
@@ -0,0 +1,160 @@
+package pmage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func copyTestFile(t *testing.T, source string, dest string) {
+	data, err := os.ReadFile(source)
+	assert.NoError(t, err)
+	assert.NoError(t, os.MkdirAll(filepath.Dir(dest), 0755))
+	assert.NoError(t, os.WriteFile(dest, data, 0644))
+}
+
+func TestBatch(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	copyTestFile(t, "test/gfx_ifont.png", filepath.Join(src, "font.png"))
+	copyTestFile(t, "test/gfx_ifont.yaml", filepath.Join(src, "font.yaml"))
+	copyTestFile(t, "test/gfx_ifont.png", filepath.Join(src, "hud", "icons.png"))
+	copyTestFile(t, "test/gfx_ifont.yaml", filepath.Join(src, "hud", "icons.yaml"))
+	copyTestFile(t, "test/gfx_ifont.png", filepath.Join(src, "hud", "bad.png"))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "hud", "bad.yaml"), []byte("colors: 3"), 0644))
+	// Images without a pmage file are skipped.
+	copyTestFile(t, "test/gfx_ifont.png", filepath.Join(src, "reference.png"))
+
+	converter := NewConverter(&Profile{System: SystemSnes})
+	out := filepath.Join(dir, "out")
+	jobs, err := FindJobs(converter, []string{src}, out, []string{"c"})
+	assert.NoError(t, err)
+	assert.Equal(t, []ConvertJob{
+		{InputPath: filepath.Join(src, "font.png"), OutputPath: filepath.Join(out, "font.c"), ExportTypes: []string{"c"}},
+		{InputPath: filepath.Join(src, "hud", "bad.png"), OutputPath: filepath.Join(out, "hud", "bad.c"), ExportTypes: []string{"c"}},
+		{InputPath: filepath.Join(src, "hud", "icons.png"), OutputPath: filepath.Join(out, "hud", "icons.c"), ExportTypes: []string{"c"}},
+	}, jobs)
+
+	results := RunJobs(converter, jobs, 2)
+	assert.Len(t, results, 3)
+	assert.NoError(t, results[0].Err)
+	assert.ErrorIs(t, results[1].Err, ErrInvalidColors)
+	assert.NoError(t, results[2].Err)
+	assert.FileExists(t, filepath.Join(out, "hud", "icons.h"))
+
+	// Globs, and outputs next to the images.
+	jobs, err = FindJobs(converter, []string{filepath.Join(src, "*.png"), filepath.Join(src, "font.png")}, "", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []ConvertJob{{InputPath: filepath.Join(src, "font.png"), OutputPath: filepath.Join(src, "font.asm")}}, jobs)
+
+	_, err = FindJobs(converter, []string{filepath.Join(dir, "missing")}, "", nil)
+	assert.ErrorIs(t, err, ErrNoInputs)
+
+	// Images with the same name in different inputs can't share an output directory.
+	copyTestFile(t, "test/gfx_ifont.png", filepath.Join(dir, "other", "font.png"))
+	copyTestFile(t, "test/gfx_ifont.yaml", filepath.Join(dir, "other", "font.yaml"))
+	_, err = FindJobs(converter, []string{src, filepath.Join(dir, "other")}, out, nil)
+	assert.ErrorIs(t, err, ErrInvalidOutput)
+	assert.ErrorContains(t, err, filepath.Join(dir, "other", "font.png"))
+	_, err = FindJobs(converter, []string{src, filepath.Join(dir, "other")}, "", nil)
+	assert.NoError(t, err)
+
+	// Files written besides the output path count too, like the ca65 include.
+	copyTestFile(t, "test/gfx_ifont.png", filepath.Join(dir, "inc", "icons.png"))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "inc", "icons.yaml"),
+		[]byte("outputs: [{type: bin, path: font.inc}]"), 0644))
+	copyTestFile(t, "test/gfx_ifont.png", filepath.Join(dir, "inc", "font.png"))
+	copyTestFile(t, "test/gfx_ifont.yaml", filepath.Join(dir, "inc", "font.yaml"))
+	_, err = FindJobs(converter, []string{filepath.Join(dir, "inc")}, "", nil)
+	assert.ErrorIs(t, err, ErrInvalidOutput)
+	assert.ErrorContains(t, err, filepath.Join(dir, "inc", "font.inc"))
+}
+
+func TestBatchSkipsOutputs(t *testing.T) {
+	dir := t.TempDir()
+	gfx := filepath.Join(dir, "gfx")
+	copyTestFile(t, "test/gfx_ifont.png", filepath.Join(gfx, "font.png"))
+	copyTestFile(t, "test/gfx_ifont.yaml", filepath.Join(gfx, "_defaults.yaml"))
+	converter := NewConverter(&Profile{System: SystemSnes})
+
+	// The preview is written next to the image, where the next build finds it.
+	for run := 0; run < 3; run++ {
+		jobs, err := FindJobs(converter, []string{gfx}, "", []string{"ca65", "preview"})
+		assert.NoError(t, err)
+		assert.Len(t, jobs, 1, "run %d", run)
+		for _, result := range RunJobs(converter, jobs, 1) {
+			assert.NoError(t, result.Err)
+		}
+	}
+	assert.FileExists(t, filepath.Join(gfx, "font.preview.png"))
+	assert.NoFileExists(t, filepath.Join(gfx, "font.preview.preview.png"))
+	assert.NoFileExists(t, filepath.Join(gfx, "font.preview.asm"))
+}
+
+// Finishes the later jobs first.
+type slowConverter struct {
+	running, maxRunning atomic.Int32
+}
+
+func (c *slowConverter) Convert(job ConvertJob) (*ConvertResult, error) {
+	running := c.running.Add(1)
+	defer c.running.Add(-1)
+	for {
+		current := c.maxRunning.Load()
+		if running <= current || c.maxRunning.CompareAndSwap(current, running) {
+			break
+		}
+	}
+
+	var n int
+	fmt.Sscanf(job.InputPath, "%d", &n)
+	time.Sleep(time.Duration(10-n) * time.Millisecond)
+	return &ConvertResult{Outputs: []string{job.OutputPath}}, nil
+}
+
+func (c *slowConverter) Plan(job ConvertJob) ([]string, error) {
+	return []string{job.OutputPath}, nil
+}
+
+func TestRunJobsOrder(t *testing.T) {
+	dir := t.TempDir()
+	jobs := []ConvertJob{}
+	for i := 0; i < 10; i++ {
+		jobs = append(jobs, ConvertJob{InputPath: fmt.Sprint(i), OutputPath: filepath.Join(dir, fmt.Sprint(i))})
+	}
+
+	converter := &slowConverter{}
+	results := RunJobs(converter, jobs, 3)
+	for i, result := range results {
+		assert.Equal(t, jobs[i], result.Job)
+		assert.Equal(t, []string{jobs[i].OutputPath}, result.Result.Outputs)
+	}
+	assert.LessOrEqual(t, converter.maxRunning.Load(), int32(3))
+	assert.Greater(t, converter.maxRunning.Load(), int32(1))
+
+	// Jobs writing the same output aren't run at the same time.
+	jobs[5].OutputPath = jobs[2].OutputPath
+	results = RunJobs(converter, jobs, 3)
+	assert.NoError(t, results[2].Err)
+	assert.ErrorIs(t, results[5].Err, ErrInvalidOutput)
+	assert.Nil(t, results[5].Result)
+	assert.NoError(t, results[6].Err)
+
+	// So are jobs that only share a derived file.
+	jobs, err := FindJobs(NewConverter(&Profile{System: SystemSnes}), []string{"test/gfx_ifont.png"}, dir, nil)
+	assert.NoError(t, err)
+	other := jobs[0]
+	other.InputPath = "test/flippy16.png"
+	other.Overrides = parseTestOverrides(t, "tiles=16x16", "bpp=4",
+		"outputs=[{type: json, path: "+filepath.Join(dir, "gfx_ifont.inc")+"}]")
+	other.OutputPath = filepath.Join(dir, "other.asm")
+	results = RunJobs(NewConverter(&Profile{System: SystemSnes}), append(jobs, other), 2)
+	assert.NoError(t, results[0].Err)
+	assert.ErrorIs(t, results[1].Err, ErrInvalidOutput)
+	assert.ErrorContains(t, results[1].Err, "gfx_ifont.inc")
+}
@@ -0,0 +1,179 @@
+package pmage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The build cache skips conversions when nothing they depend on has changed. For each
+// output, it stores a hash of the settings (profile, export types, pmage version) and of
+// each dependency's contents. A conversion is skipped if the settings match, the
+// dependencies have the same contents, no missing pmage or defaults files were added, and
+// the outputs still exist.
+type BuildCache struct {
+	Dir string
+
+	// Changing the version invalidates everything, since the output may be different.
+	Version string
+}
+
+type cacheEntry struct {
+	Settings     string            `json:"settings"`
+	Dependencies map[string]string `json:"dependencies"` // Path to content hash.
+	Result       ConvertResult     `json:"result"`
+}
+
+func hashFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Layers from files are hashed by their source, which is also a dependency. Others are
+// hashed by their name, which has the options.
+func (c *BuildCache) settingsHash(profile *Profile, job ConvertJob) string {
+	layerNames := func(layers []OptionLayer) []string {
+		names := []string{}
+		for _, layer := range layers {
+			names = append(names, layer.Source+layer.Name)
+		}
+		return names
+	}
+	settings, _ := json.Marshal(struct {
+		Version     string
+		Profile     *Profile
+		Input       string
+		Output      string
+		ExportTypes []string
+		Layers      []string
+		Overrides   []string
+	}{c.Version, profile, job.InputPath, job.OutputPath, job.ExportTypes,
+		layerNames(job.Layers), layerNames(job.Overrides)})
+	sum := sha256.Sum256(settings)
+	return hex.EncodeToString(sum[:])
+}
+
+// Entries are named after the output path.
+func (c *BuildCache) entryPath(outputPath string) string {
+	abs, err := filepath.Abs(outputPath)
+	if err != nil {
+		abs = outputPath
+	}
+	sum := sha256.Sum256([]byte(abs))
+	return filepath.Join(c.Dir, hex.EncodeToString(sum[:16])+".json")
+}
+
+// Returns the result of the previous conversion if it's still up to date.
+func (c *BuildCache) Lookup(profile *Profile, job ConvertJob) (*ConvertResult, bool) {
+	data, err := os.ReadFile(c.entryPath(job.OutputPath))
+	if err != nil {
+		return nil, false
+	}
+	var entry cacheEntry
+	if err = json.Unmarshal(data, &entry); err != nil {
+		return nil, false
+	}
+
+	if entry.Settings != c.settingsHash(profile, job) {
+		return nil, false
+	}
+	for _, dep := range entry.Result.Dependencies {
+		hash, err := hashFile(dep)
+		if err != nil || hash != entry.Dependencies[dep] {
+			return nil, false
+		}
+	}
+	for _, missing := range entry.Result.Missing {
+		if _, err := os.Stat(missing); err == nil {
+			return nil, false
+		}
+	}
+	for _, output := range entry.Result.Outputs {
+		if _, err := os.Stat(output); err != nil {
+			return nil, false
+		}
+	}
+
+	result := entry.Result
+	result.Cached = true
+	return &result, true
+}
+
+// Records a finished conversion.
+func (c *BuildCache) Store(profile *Profile, job ConvertJob, result *ConvertResult) error {
+	entry := cacheEntry{
+		Settings:     c.settingsHash(profile, job),
+		Dependencies: map[string]string{},
+		Result:       *result,
+	}
+	entry.Result.Cached = false
+	for _, dep := range result.Dependencies {
+		hash, err := hashFile(dep)
+		if err != nil {
+			return err
+		}
+		entry.Dependencies[dep] = hash
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(c.Dir, 0755); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first, so an interrupted build can't leave a broken entry.
+	path := c.entryPath(job.OutputPath)
+	temp, err := os.CreateTemp(c.Dir, strings.TrimSuffix(filepath.Base(path), ".json")+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+	if _, err = temp.Write(data); err != nil {
+		temp.Close()
+		return err
+	}
+	if err = temp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), path)
+}
+
+type cachedConverter struct {
+	converter Converter
+	profile   *Profile
+	cache     *BuildCache
+}
+
+// Wraps a converter to skip conversions that are up to date in the cache. Results from
+// the cache have Cached set.
+func NewCachedConverter(converter Converter, profile *Profile, cache *BuildCache) Converter {
+	return &cachedConverter{converter, profile, cache}
+}
+
+func (c *cachedConverter) Convert(job ConvertJob) (*ConvertResult, error) {
+	if result, ok := c.cache.Lookup(c.profile, job); ok {
+		return result, nil
+	}
+
+	result, err := c.converter.Convert(job)
+	if err != nil {
+		return nil, err
+	}
+	if err = c.cache.Store(c.profile, job, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (c *cachedConverter) Plan(job ConvertJob) ([]string, error) {
+	return c.converter.Plan(job)
+}
@@ -0,0 +1,82 @@
+package pmage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Counts the conversions that weren't skipped.
+type countingConverter struct {
+	converter Converter
+	count     int
+}
+
+func (c *countingConverter) Convert(job ConvertJob) (*ConvertResult, error) {
+	c.count++
+	return c.converter.Convert(job)
+}
+
+func (c *countingConverter) Plan(job ConvertJob) ([]string, error) {
+	return c.converter.Plan(job)
+}
+
+func TestBuildCache(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "font.png")
+	output := filepath.Join(dir, "out", "font.asm")
+	copyTestFile(t, "test/gfx_ifont.png", input)
+	copyTestFile(t, "test/gfx_ifont.yaml", filepath.Join(dir, "font.yaml"))
+	assert.NoError(t, os.MkdirAll(filepath.Dir(output), 0755))
+
+	profile := &Profile{System: SystemSnes}
+	cache := &BuildCache{Dir: filepath.Join(dir, "cache"), Version: "1"}
+	counter := &countingConverter{converter: NewConverter(profile)}
+	converter := NewCachedConverter(counter, profile, cache)
+
+	convert := func() *ConvertResult {
+		result, err := converter.Convert(ConvertJob{InputPath: input, OutputPath: output, ExportTypes: []string{"ca65"}})
+		assert.NoError(t, err)
+		return result
+	}
+
+	assert.False(t, convert().Cached)
+	result := convert()
+	assert.True(t, result.Cached)
+	assert.Equal(t, []string{output, filepath.Join(dir, "out", "font.inc")}, result.Outputs)
+	assert.Equal(t, []string{input, filepath.Join(dir, "font.yaml")}, result.Dependencies)
+	assert.Equal(t, 1, counter.count)
+
+	// Changed pmage file
+	f, err := os.OpenFile(filepath.Join(dir, "font.yaml"), os.O_APPEND|os.O_WRONLY, 0644)
+	assert.NoError(t, err)
+	f.WriteString("\n# changed\n")
+	f.Close()
+	assert.False(t, convert().Cached)
+	assert.True(t, convert().Cached)
+
+	// Missing output
+	assert.NoError(t, os.Remove(output))
+	assert.False(t, convert().Cached)
+	assert.NoError(t, os.Remove(filepath.Join(dir, "out", "font.inc")))
+	assert.False(t, convert().Cached)
+
+	// New defaults file
+	assert.True(t, convert().Cached)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "_defaults.yaml"), []byte("segment: GFX"), 0644))
+	assert.False(t, convert().Cached)
+	assert.True(t, convert().Cached)
+
+	// Different options
+	profile.Labels.Case = LabelCaseUpper
+	assert.False(t, convert().Cached)
+	cache.Version = "2"
+	assert.False(t, convert().Cached)
+	result, err = converter.Convert(ConvertJob{InputPath: input, OutputPath: output, ExportTypes: []string{"ca65", "json"}})
+	assert.NoError(t, err)
+	assert.False(t, result.Cached)
+
+	assert.Equal(t, 8, counter.count)
+}
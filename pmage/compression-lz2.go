@@ -0,0 +1,242 @@
+package pmage
+
+import "fmt"
+
+// This compressor implements Nintendo's LZ2 format (Lunar Compress "LC_LZ2"), which is
+// used by many first-party SNES games and has small, fast 65816 decompressors.
+//
+// The stream is a series of commands, each starting with a header:
+//
+//	CCCLLLLL            Command C, length L+1 (1-32).
+//	111CCCLL LLLLLLLL   Extended header, command C, length L+1 (1-1024).
+//	11111111            End of data.
+//
+// Commands:
+//
+//	0 Direct copy     - L+1 bytes follow and are copied to the output.
+//	1 Byte fill       - One byte follows and is written L+1 times.
+//	2 Word fill       - Two bytes follow and are written alternately, L+1 bytes total.
+//	3 Increasing fill - One byte follows and is written L+1 times, incrementing after
+//	                    each write.
+//	4 Repeat          - A two-byte offset follows (high byte first). L+1 bytes are copied
+//	                    from that absolute position in the output.
+type Lz2Compressor struct{}
+
+const (
+	lz2CmdDirectCopy     = 0
+	lz2CmdByteFill       = 1
+	lz2CmdWordFill       = 2
+	lz2CmdIncreasingFill = 3
+	lz2CmdRepeat         = 4
+
+	lz2MaxLength = 1024
+	lz2MaxOffset = 0xFFFF
+	lz2End       = 0xFF
+
+	// How many previous positions are checked when searching for a repeat.
+	lz2SearchDepth = 512
+)
+
+func init() {
+	registerCompressor(&Lz2Compressor{})
+}
+
+func (c *Lz2Compressor) Name() string {
+	return "lz2"
+}
+
+func (c *Lz2Compressor) Format() PixelCompression {
+	return PixelCompressionLz2
+}
+
+func lz2HeaderSize(length int) int {
+	if length > 32 {
+		return 2
+	}
+	return 1
+}
+
+func lz2AppendHeader(out []byte, cmd int, length int) []byte {
+	l := length - 1
+	if l < 32 {
+		return append(out, byte(cmd<<5|l))
+	}
+	return append(out, byte(0xE0|cmd<<2|l>>8), byte(l))
+}
+
+func (c *Lz2Compressor) Compress(data []byte) []byte {
+	result := []byte{}
+	literals := []byte{}
+
+	flushLiterals := func() {
+		for len(literals) > 0 {
+			n := min(len(literals), lz2MaxLength)
+			result = lz2AppendHeader(result, lz2CmdDirectCopy, n)
+			result = append(result, literals[:n]...)
+			literals = literals[n:]
+		}
+	}
+
+	// Previous positions in the data, keyed by the three bytes that start there. Only
+	// positions that can be addressed by a repeat command are recorded.
+	chains := make(map[uint32][]int)
+	indexed := 0
+	key := func(pos int) uint32 {
+		return uint32(data[pos]) | uint32(data[pos+1])<<8 | uint32(data[pos+2])<<16
+	}
+
+	cursor := 0
+	for cursor < len(data) {
+		for ; indexed < cursor && indexed+3 <= len(data) && indexed <= lz2MaxOffset; indexed++ {
+			k := key(indexed)
+			chains[k] = append(chains[k], indexed)
+		}
+
+		remaining := min(len(data)-cursor, lz2MaxLength)
+
+		bestCmd := lz2CmdDirectCopy
+		bestLen := 0
+		bestGain := 0
+		bestOffset := 0
+
+		consider := func(cmd int, length int, payload int) bool {
+			gain := length - lz2HeaderSize(length) - payload
+			if gain > bestGain {
+				bestCmd, bestLen, bestGain = cmd, length, gain
+				return true
+			}
+			return false
+		}
+
+		length := 1
+		for length < remaining && data[cursor+length] == data[cursor] {
+			length++
+		}
+		consider(lz2CmdByteFill, length, 1)
+
+		if remaining >= 2 {
+			length = 2
+			for length < remaining && data[cursor+length] == data[cursor+(length&1)] {
+				length++
+			}
+			consider(lz2CmdWordFill, length, 2)
+		}
+
+		length = 1
+		for length < remaining && data[cursor+length] == data[cursor]+byte(length) {
+			length++
+		}
+		consider(lz2CmdIncreasingFill, length, 1)
+
+		if remaining >= 3 {
+			chain := chains[key(cursor)]
+			for i := len(chain) - 1; i >= 0 && i >= len(chain)-lz2SearchDepth; i-- {
+				pos := chain[i]
+				length = 0
+				for length < remaining && data[pos+length] == data[cursor+length] {
+					length++
+				}
+				if consider(lz2CmdRepeat, length, 2) {
+					bestOffset = pos
+				}
+				if length == remaining {
+					break
+				}
+			}
+		}
+
+		if bestGain <= 0 {
+			literals = append(literals, data[cursor])
+			cursor++
+			continue
+		}
+
+		flushLiterals()
+		result = lz2AppendHeader(result, bestCmd, bestLen)
+		switch bestCmd {
+		case lz2CmdByteFill, lz2CmdIncreasingFill:
+			result = append(result, data[cursor])
+		case lz2CmdWordFill:
+			result = append(result, data[cursor], data[cursor+1])
+		case lz2CmdRepeat:
+			result = append(result, byte(bestOffset>>8), byte(bestOffset))
+		}
+		cursor += bestLen
+	}
+
+	flushLiterals()
+	result = append(result, lz2End)
+	return result
+}
+
+func (c *Lz2Compressor) Decompress(compressed []byte) ([]byte, error) {
+	readpos := 0
+	outOfData := false
+	getbyte := func() byte {
+		if readpos >= len(compressed) {
+			outOfData = true
+			return lz2End
+		}
+		b := compressed[readpos]
+		readpos++
+		return b
+	}
+	result := []byte{}
+
+	for {
+		header := getbyte()
+		if header == lz2End {
+			break
+		}
+
+		cmd := int(header >> 5)
+		length := int(header&0x1F) + 1
+		if cmd == 7 {
+			cmd = int(header>>2) & 7
+			length = (int(header&3)<<8 | int(getbyte())) + 1
+		}
+
+		switch cmd {
+		case lz2CmdDirectCopy:
+			for i := 0; i < length; i++ {
+				result = append(result, getbyte())
+			}
+		case lz2CmdByteFill:
+			b := getbyte()
+			for i := 0; i < length; i++ {
+				result = append(result, b)
+			}
+		case lz2CmdWordFill:
+			b := [2]byte{getbyte(), getbyte()}
+			for i := 0; i < length; i++ {
+				result = append(result, b[i&1])
+			}
+		case lz2CmdIncreasingFill:
+			b := getbyte()
+			for i := 0; i < length; i++ {
+				result = append(result, b)
+				b++
+			}
+		case lz2CmdRepeat:
+			offset := int(getbyte())<<8 | int(getbyte())
+			if offset >= len(result) {
+				return nil, fmt.Errorf("%w: invalid lz2 repeat offset", ErrCorruptData)
+			}
+			for i := 0; i < length; i++ {
+				result = append(result, result[offset+i])
+			}
+		default:
+			return nil, fmt.Errorf("%w: invalid lz2 command %d", ErrCorruptData, cmd)
+		}
+
+		if outOfData {
+			return nil, fmt.Errorf("%w: unexpected end of lz2 data", ErrCorruptData)
+		}
+	}
+
+	if outOfData {
+		return nil, fmt.Errorf("%w: missing lz2 end marker", ErrCorruptData)
+	}
+
+	return result, nil
+}
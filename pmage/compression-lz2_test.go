@@ -0,0 +1,147 @@
+package pmage
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Reference decoder, written to follow a typical 65816 LZ2 decompression loop.
+func decompressLz2(compressed []byte) []byte {
+	readpos := 0
+	getbyte := func() byte {
+		if readpos >= len(compressed) {
+			panic("out of data")
+		}
+		b := compressed[readpos]
+		readpos++
+		return b
+	}
+	result := []byte{}
+
+	for {
+		header := getbyte()
+		if header == 0xFF {
+			break
+		}
+
+		cmd := int(header >> 5)
+		length := int(header&0x1F) + 1
+		if cmd == 7 {
+			cmd = int(header>>2) & 7
+			length = (int(header&3)<<8 | int(getbyte())) + 1
+		}
+
+		switch cmd {
+		case 0:
+			for i := 0; i < length; i++ {
+				result = append(result, getbyte())
+			}
+		case 1:
+			b := getbyte()
+			for i := 0; i < length; i++ {
+				result = append(result, b)
+			}
+		case 2:
+			b := [2]byte{getbyte(), getbyte()}
+			for i := 0; i < length; i++ {
+				result = append(result, b[i&1])
+			}
+		case 3:
+			b := getbyte()
+			for i := 0; i < length; i++ {
+				result = append(result, b)
+				b++
+			}
+		case 4:
+			offset := int(getbyte())<<8 | int(getbyte())
+			for i := 0; i < length; i++ {
+				result = append(result, result[offset+i])
+			}
+		default:
+			panic("invalid command")
+		}
+	}
+
+	return result
+}
+
+func TestLz2CompressionSimple(t *testing.T) {
+	compressor := Lz2Compressor{}
+
+	// Byte fill
+	assert.Equal(t, []byte{0x29, 0x55, 0xFF},
+		compressor.Compress([]byte{0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55}))
+
+	// Word fill
+	assert.Equal(t, []byte{0x45, 0x12, 0x34, 0xFF},
+		compressor.Compress([]byte{0x12, 0x34, 0x12, 0x34, 0x12, 0x34}))
+
+	// Increasing fill
+	assert.Equal(t, []byte{0x67, 0xFE, 0xFF},
+		compressor.Compress([]byte{0xFE, 0xFF, 0x00, 0x01, 0x02, 0x03, 0x04, 0x05}))
+
+	// Direct copy followed by a repeat
+	assert.Equal(t, []byte{0x03, 1, 5, 2, 7, 0x87, 0x00, 0x00, 0xFF},
+		compressor.Compress([]byte{1, 5, 2, 7, 1, 5, 2, 7, 1, 5, 2, 7}))
+
+	// Empty
+	assert.Equal(t, []byte{0xFF}, compressor.Compress([]byte{}))
+}
+
+func TestLz2CompressionLongRuns(t *testing.T) {
+	original := make([]byte, 3000)
+	for i := 1000; i < 1100; i++ {
+		original[i] = byte(i)
+	}
+
+	compressor := Lz2Compressor{}
+	compressed := compressor.Compress(original)
+
+	// Extended header for the first 1000 bytes.
+	assert.Equal(t, []byte{0xE7, 0xE7, 0x00}, compressed[:3])
+	assert.Equal(t, original, decompressLz2(compressed))
+	decompressed, err := compressor.Decompress(compressed)
+	assert.NoError(t, err)
+	assert.Equal(t, original, decompressed)
+}
+
+func TestLz2CompressionRandom(t *testing.T) {
+	for test := 0; test < 10; test++ {
+		original := []byte{}
+		for i := 0; i < 6000+test; i++ {
+			value := byte(rand.Intn(1+(test%10)) << (test % 4))
+			original = append(original, value)
+		}
+		compressor := Lz2Compressor{}
+		compressed := compressor.Compress(original)
+		assert.Equal(t, original, decompressLz2(compressed))
+		decompressed, err := compressor.Decompress(compressed)
+		assert.NoError(t, err)
+		assert.Equal(t, original, decompressed)
+	}
+}
+
+// Known streams, so the decompressor isn't only checked against the compressor.
+func TestLz2Decompress(t *testing.T) {
+	compressor := Lz2Compressor{}
+	for _, test := range []struct {
+		compressed []byte
+		expected   []byte
+	}{
+		{[]byte{0x02, 1, 2, 3, 0xFF}, []byte{1, 2, 3}},
+		{[]byte{0x23, 0xAA, 0xFF}, []byte{0xAA, 0xAA, 0xAA, 0xAA}},
+		{[]byte{0x44, 0x12, 0x34, 0xFF}, []byte{0x12, 0x34, 0x12, 0x34, 0x12}},
+		{[]byte{0x63, 0xFE, 0xFF}, []byte{0xFE, 0xFF, 0x00, 0x01}},
+		{[]byte{0x01, 7, 8, 0x84, 0x00, 0x00, 0xFF}, []byte{7, 8, 7, 8, 7, 8, 7}},
+		{[]byte{0xE5, 0x01, 0x09, 0xFF}, bytes.Repeat([]byte{9}, 258)},
+		{[]byte{0xFF}, []byte{}},
+	} {
+		decompressed, err := compressor.Decompress(test.compressed)
+		assert.NoError(t, err)
+		assert.Equal(t, test.expected, decompressed)
+		assert.Equal(t, test.expected, decompressLz2(test.compressed))
+	}
+}
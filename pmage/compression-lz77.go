@@ -1,9 +1,23 @@
 package pmage
 
+import "fmt"
+
 // This compressor implements the LZ77 compression algorithm as expected by the Gameboy
 // Advance BIOS functions. See GBATEK LZ77UnCompReadNormalWrite8bit.
 type Lz77Compressor struct{}
 
+func init() {
+	registerCompressor(&Lz77Compressor{})
+}
+
+func (c *Lz77Compressor) Name() string {
+	return "lz77"
+}
+
+func (c *Lz77Compressor) Format() PixelCompression {
+	return PixelCompressionLz77
+}
+
 func (c *Lz77Compressor) Compress(data []byte) []byte {
 	result := []byte{}
 
@@ -61,3 +75,61 @@ func (c *Lz77Compressor) Compress(data []byte) []byte {
 
 	return result
 }
+
+func (c *Lz77Compressor) Decompress(compressed []byte) ([]byte, error) {
+	readpos := 0
+	outOfData := false
+	getbyte := func() byte {
+		if readpos >= len(compressed) {
+			outOfData = true
+			return 0
+		}
+		b := compressed[readpos]
+		readpos++
+		return b
+	}
+
+	if getbyte() != 0x10 {
+		return nil, fmt.Errorf("%w: invalid lz77 header", ErrCorruptData)
+	}
+
+	originalLength := int(getbyte()) | (int(getbyte()) << 8) | (int(getbyte()) << 16)
+	result := make([]byte, 0, originalLength)
+
+	for len(result) < originalLength && !outOfData {
+		blockflags := getbyte()
+
+		for block := 0; block < 8; block++ {
+			if len(result) >= originalLength || outOfData {
+				// All data decompressed - terminate the block cycle
+				break
+			}
+
+			if blockflags&(1<<(7-block)) != 0 {
+				// Compressed block
+				a := getbyte()
+				disp := int(a&0xF) << 8
+				copylength := (int(a) >> 4) + 3
+				disp |= int(getbyte())
+				disp += 1
+
+				resultpos := len(result)
+				if disp > resultpos {
+					return nil, fmt.Errorf("%w: invalid lz77 displacement", ErrCorruptData)
+				}
+				for i := 0; i < copylength; i++ {
+					result = append(result, result[resultpos-disp+i])
+				}
+			} else {
+				// Raw block
+				result = append(result, getbyte())
+			}
+		}
+	}
+
+	if outOfData {
+		return nil, fmt.Errorf("%w: unexpected end of lz77 data", ErrCorruptData)
+	}
+
+	return result[:originalLength], nil
+}
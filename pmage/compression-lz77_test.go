@@ -79,7 +79,9 @@ func TestLz77CompressionRandom(t *testing.T) {
 		}
 		compressor := Lz77Compressor{}
 		compressed := compressor.Compress(original)
-		decompressed := decompressLz77(compressed)
+		assert.Equal(t, original, decompressLz77(compressed))
+		decompressed, err := compressor.Decompress(compressed)
+		assert.NoError(t, err)
 		assert.Equal(t, original, decompressed)
 	}
 }
@@ -1,17 +1,177 @@
 package pmage
 
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+)
+
 type Compressor interface {
+	// The name used to select this compressor in pmage files.
+	Name() string
+
+	// The ID of this compressor's format. It's exported alongside compressed data when
+	// the compressor is chosen automatically, so runtime code can dispatch on it.
+	Format() PixelCompression
+
 	Compress(data []byte) []byte
+
+	// Reverses Compress. Returns ErrCorruptData if the data can't be decoded.
+	Decompress(data []byte) ([]byte, error)
+}
+
+var ErrCorruptData = errors.New("corrupt compressed data")
+var ErrVerification = errors.New("compression verification failed")
+
+// Compressors register themselves here from init().
+var compressors []Compressor
+
+func registerCompressor(c Compressor) {
+	compressors = append(compressors, c)
+}
+
+func findCompressor(format PixelCompression) Compressor {
+	for _, c := range compressors {
+		if c.Format() == format {
+			return c
+		}
+	}
+	return nil
 }
 
-func applyCompression(data []byte, comp PixelCompression) []byte {
+func findCompressorByName(name string) Compressor {
+	for _, c := range compressors {
+		if c.Name() == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// Returns the name used for the scheme in pmage files, e.g. "lz2".
+func (c PixelCompression) String() string {
+	switch c {
+	case PixelCompressionNone:
+		return "none"
+	case PixelCompressionAuto:
+		return "auto"
+	}
+	if compressor := findCompressor(c); compressor != nil {
+		return compressor.Name()
+	}
+	return fmt.Sprintf("unknown(%d)", int(c))
+}
+
+// Parses a compression scheme by name, e.g. "lz2". Empty means none.
+func ParsePixelCompression(scheme string) (PixelCompression, error) {
+	scheme = strings.TrimSpace(scheme)
+	scheme = strings.ToLower(scheme)
+	switch scheme {
+	case "", "none":
+		return PixelCompressionNone, nil
+	case "auto":
+		return PixelCompressionAuto, nil
+	}
+
+	compressor := findCompressorByName(scheme)
+	if compressor == nil {
+		return PixelCompressionNone, fmt.Errorf("invalid compression: %s", scheme)
+	}
+	return compressor.Format(), nil
+}
+
+// Returns the compressed data and the scheme that was used. With PixelCompressionAuto,
+// every registered compressor is tried and the smallest result wins. The data is left
+// uncompressed if none of them make it smaller.
+//
+// The result is always decompressed again and checked against the source, so a faulty
+// compressor fails the conversion instead of producing broken output.
+func applyCompression(data []byte, comp PixelCompression) ([]byte, PixelCompression, error) {
+	var compressor Compressor
 	switch comp {
-	case PixelCompressionLz77:
-		compressor := Lz77Compressor{}
-		return compressor.Compress(data)
 	case PixelCompressionNone:
-		return data
-	default:
+		return data, PixelCompressionNone, nil
+	case PixelCompressionAuto:
+		best := data
+		for _, c := range compressors {
+			compressed := c.Compress(data)
+			if len(compressed) < len(best) {
+				best, compressor = compressed, c
+			}
+		}
+		if compressor == nil {
+			return data, PixelCompressionNone, nil
+		}
+		return best, compressor.Format(), verifyCompression(compressor, data, best)
+	}
+
+	compressor = findCompressor(comp)
+	if compressor == nil {
 		panic("unknown compression scheme")
 	}
+	compressed := compressor.Compress(data)
+	return compressed, comp, verifyCompression(compressor, data, compressed)
+}
+
+// Compresses each chunk separately. All chunks use the same scheme; with
+// PixelCompressionAuto, that's the one with the smallest total size.
+func applyChunkedCompression(chunks [][]byte, comp PixelCompression) ([][]byte, PixelCompression, error) {
+	if comp != PixelCompressionAuto {
+		result := make([][]byte, len(chunks))
+		for i, chunk := range chunks {
+			var err error
+			if result[i], _, err = applyCompression(chunk, comp); err != nil {
+				return nil, comp, err
+			}
+		}
+		return result, comp, nil
+	}
+
+	var best [][]byte
+	bestFormat, bestSize := PixelCompressionNone, 0
+	candidates := []PixelCompression{PixelCompressionNone}
+	for _, c := range compressors {
+		candidates = append(candidates, c.Format())
+	}
+
+	for _, candidate := range candidates {
+		result, _, err := applyChunkedCompression(chunks, candidate)
+		if err != nil {
+			return nil, candidate, err
+		}
+		size := 0
+		for _, chunk := range result {
+			size += len(chunk)
+		}
+		if best == nil || size < bestSize {
+			best, bestFormat, bestSize = result, candidate, size
+		}
+	}
+
+	return best, bestFormat, nil
+}
+
+func verifyCompression(compressor Compressor, source []byte, compressed []byte) error {
+	decompressed, err := compressor.Decompress(compressed)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrVerification, compressor.Name(), err)
+	}
+	if !bytes.Equal(source, decompressed) {
+		return fmt.Errorf("%w: %s: output does not match the source", ErrVerification, compressor.Name())
+	}
+	return nil
+}
+
+// Decodes data that was compressed with the given scheme.
+func Decompress(data []byte, comp PixelCompression) ([]byte, error) {
+	if comp == PixelCompressionNone {
+		return data, nil
+	}
+
+	compressor := findCompressor(comp)
+	if compressor == nil {
+		return nil, fmt.Errorf("%w: unknown compression scheme", ErrUnsupported)
+	}
+	return compressor.Decompress(data)
 }
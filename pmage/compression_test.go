@@ -0,0 +1,87 @@
+package pmage
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompressorRegistry(t *testing.T) {
+	assert.Equal(t, PixelCompressionLz77, findCompressorByName("lz77").Format())
+	assert.Equal(t, PixelCompressionLz2, findCompressorByName("lz2").Format())
+	assert.Nil(t, findCompressorByName("none"))
+	assert.Nil(t, findCompressor(PixelCompressionNone))
+}
+
+func TestAutoCompression(t *testing.T) {
+	// LZ2 can encode this as one fill command.
+	zeros := make([]byte, 1000)
+	compressed, format, err := applyCompression(zeros, PixelCompressionAuto)
+	assert.NoError(t, err)
+	assert.Equal(t, PixelCompressionLz2, format)
+	assert.Len(t, compressed, 4)
+
+	// Noise shouldn't compress, so it's left as is.
+	noise := make([]byte, 2000)
+	rand.New(rand.NewSource(1)).Read(noise)
+	compressed, format, err = applyCompression(noise, PixelCompressionAuto)
+	assert.NoError(t, err)
+	assert.Equal(t, PixelCompressionNone, format)
+	assert.Equal(t, noise, compressed)
+
+	pmf, err := CreatePmageFileFromYamlString(&Profile{System: "snes"}, "compression: auto", "test.yaml")
+	assert.NoError(t, err)
+	assert.Equal(t, PixelCompressionAuto, pmf.Compression)
+}
+
+// Drops the last byte, so verification should catch it.
+type brokenCompressor struct{}
+
+func (c *brokenCompressor) Name() string             { return "broken" }
+func (c *brokenCompressor) Format() PixelCompression { return 100 }
+func (c *brokenCompressor) Compress(data []byte) []byte {
+	return data[:len(data)-1]
+}
+func (c *brokenCompressor) Decompress(data []byte) ([]byte, error) {
+	return data, nil
+}
+
+func TestCompressionVerification(t *testing.T) {
+	registerCompressor(&brokenCompressor{})
+	defer func() { compressors = compressors[:len(compressors)-1] }()
+
+	_, _, err := applyCompression([]byte{1, 2, 3, 4}, 100)
+	assert.ErrorIs(t, err, ErrVerification)
+
+	// Auto picks the smallest, which is the broken one here.
+	_, _, err = applyCompression([]byte{1, 5, 2, 7}, PixelCompressionAuto)
+	assert.ErrorIs(t, err, ErrVerification)
+}
+
+func TestDecompressCorruptData(t *testing.T) {
+	_, err := Decompress([]byte{0x11, 0x00, 0x00, 0x00}, PixelCompressionLz77)
+	assert.ErrorIs(t, err, ErrCorruptData)
+
+	// Displacement before the start of the output.
+	_, err = Decompress([]byte{0x10, 0x04, 0x00, 0x00, 0x80, 0x00, 0x05}, PixelCompressionLz77)
+	assert.ErrorIs(t, err, ErrCorruptData)
+
+	// Missing end marker.
+	_, err = Decompress([]byte{0x29, 0x55}, PixelCompressionLz2)
+	assert.ErrorIs(t, err, ErrCorruptData)
+
+	// Repeat from past the end of the output.
+	_, err = Decompress([]byte{0x80, 0x00, 0x10, 0xFF}, PixelCompressionLz2)
+	assert.ErrorIs(t, err, ErrCorruptData)
+
+	_, err = Decompress([]byte{}, 100)
+	assert.ErrorIs(t, err, ErrUnsupported)
+}
+
+func TestCompressionNames(t *testing.T) {
+	assert.Equal(t, "none", PixelCompressionNone.String())
+	assert.Equal(t, "auto", PixelCompressionAuto.String())
+	assert.Equal(t, "lz77", PixelCompressionLz77.String())
+	assert.Equal(t, "lz2", PixelCompressionLz2.String())
+}
@@ -6,11 +6,49 @@ import (
 	_ "image/png"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 )
 
 type Converter interface {
-	Convert(inputPath string, outputPath string, exportType string) error
+	// Converts the job's image and writes each of its export types. The first export is
+	// written to the output path, and the rest next to it with the extension of their
+	// type. Outputs listed in the pmage file are added after them. With no exports at all,
+	// ca65 is used.
+	Convert(job ConvertJob) (*ConvertResult, error)
+
+	// Returns every file Convert would write for the job, without converting it, so batches
+	// can check that no two jobs write the same file.
+	Plan(job ConvertJob) ([]string, error)
+}
+
+// A single conversion.
+type ConvertJob struct {
+	InputPath   string
+	OutputPath  string
+	ExportTypes []string
+
+	// Options applied before the image's pmage file, e.g. from a project file.
+	Layers []OptionLayer
+
+	// Options applied after the image's pmage file, e.g. from the command line.
+	Overrides []OptionLayer
+}
+
+// Describes the files of a conversion, e.g. for writing a dependency file.
+type ConvertResult struct {
+	// The output path of each export.
+	Outputs []string
+
+	// The files the conversion read: the image and the pmage files.
+	Dependencies []string
+
+	// Files that don't exist, but would change the result if they were created, like a
+	// missing pmage file or defaults file.
+	Missing []string
+
+	// Set if the conversion was skipped because the outputs were up to date.
+	Cached bool
 }
 
 type converter struct {
@@ -23,6 +61,45 @@ func NewConverter(profile *Profile) Converter {
 	}
 }
 
+type exportType struct {
+	name   string
+	ext    string // For derived output paths.
+	create func() Exporter
+}
+
+var exportTypes = []exportType{
+	{"ca65", ".asm", func() Exporter { return &Ca65Exporter{} }},
+	{"c", ".c", func() Exporter { return &CExporter{} }},
+	{"bin", ".bin", func() Exporter { return &BinExporter{} }},
+	{"bin-asar", ".bin", func() Exporter { return &BinExporter{Assembler: "asar"} }},
+	{"bin-wla", ".bin", func() Exporter { return &BinExporter{Assembler: "wla"} }},
+	{"wla", ".asm", func() Exporter { return &WlaExporter{} }},
+	{"asar", ".asm", func() Exporter { return &AsarExporter{} }},
+	{"preview", ".png", func() Exporter { return &PreviewExporter{} }},
+	{"json", ".json", func() Exporter { return &JsonExporter{} }},
+}
+
+func findExportType(name string) *exportType {
+	for i := range exportTypes {
+		if exportTypes[i].name == name {
+			return &exportTypes[i]
+		}
+	}
+	return nil
+}
+
+func isExportType(name string) bool {
+	return findExportType(name) != nil
+}
+
+func exportTypeNames() string {
+	names := []string{}
+	for _, t := range exportTypes {
+		names = append(names, t.name)
+	}
+	return strings.Join(names, ", ")
+}
+
 func changeExt(inputPath string, newExt string) string {
 	dir := filepath.Dir(inputPath)
 	base := filepath.Base(inputPath)
@@ -31,38 +108,180 @@ func changeExt(inputPath string, newExt string) string {
 	return filepath.Join(dir, name+newExt)
 }
 
-func (c *converter) Convert(inputPath string, outputPath string, exportType string) (rerr error) {
+// Decides where each export is written. Exports without a path get the output path if
+// it's free, otherwise the output path with their type's extension, or with the type
+// name before the extension if that's taken too, e.g. font.wla.asm. Exports with the
+// same type and path are only written once. Nothing is written to the input paths.
+func resolveOutputs(outputPath string, exportTypes []string, extra []Output, inputs []string) ([]Output, error) {
+	requested := []Output{}
+	for _, name := range exportTypes {
+		requested = append(requested, Output{Type: strings.ToLower(strings.TrimSpace(name))})
+	}
+	requested = append(requested, extra...)
+	if len(requested) == 0 {
+		requested = append(requested, Output{Type: "ca65"})
+	}
+
+	outputs := []Output{}
+	used := map[string]string{}
+	for _, input := range inputs {
+		used[filepath.Clean(input)] = "input"
+	}
+	for _, output := range requested {
+		t := findExportType(output.Type)
+		if t == nil {
+			return nil, fmt.Errorf("Unknown export type \"%s\". Valid export types are [%s]",
+				output.Type, exportTypeNames())
+		}
+
+		if output.Path == "" {
+			for _, path := range []string{
+				outputPath, changeExt(outputPath, t.ext), changeExt(outputPath, "."+t.name+t.ext),
+			} {
+				if other, ok := used[filepath.Clean(path)]; !ok || other == t.name {
+					output.Path = path
+					break
+				}
+			}
+			if output.Path == "" {
+				return nil, fmt.Errorf("%w: no free path for the %s export", ErrInvalidOutput, t.name)
+			}
+		}
+		if other, ok := used[filepath.Clean(output.Path)]; ok {
+			if other == t.name {
+				continue
+			}
+			if other == "input" {
+				return nil, fmt.Errorf("%w: the %s export would overwrite %s", ErrInvalidOutput, t.name, output.Path)
+			}
+			return nil, fmt.Errorf("%w: %s and %s exports are both written to %s",
+				ErrInvalidOutput, other, t.name, output.Path)
+		}
+
+		used[filepath.Clean(output.Path)] = t.name
+		outputs = append(outputs, output)
+	}
+
+	return outputs, nil
+}
+
+// Creates the exporter for each output and finds the files it writes. It's an error for
+// an export to write over an input or another export's files.
+func planExports(product *Product, outputs []Output, inputs []string) ([]Exporter, [][]string, error) {
+	exporters := make([]Exporter, len(outputs))
+	files := make([][]string, len(outputs))
+	used := map[string]string{}
+	for _, input := range inputs {
+		used[filepath.Clean(input)] = "input"
+	}
+
+	for i, output := range outputs {
+		exporters[i] = findExportType(output.Type).create()
+		var err error
+		if files[i], err = exportFiles(exporters[i], product, output.Path); err != nil {
+			return nil, nil, err
+		}
+		for _, file := range files[i] {
+			other, ok := used[filepath.Clean(file)]
+			if ok && other == "input" {
+				return nil, nil, fmt.Errorf("%w: the %s export would overwrite %s", ErrInvalidOutput, output.Type, file)
+			} else if ok {
+				return nil, nil, fmt.Errorf("%w: %s and %s exports both write %s",
+					ErrInvalidOutput, other, output.Type, file)
+			}
+			used[filepath.Clean(file)] = output.Type
+		}
+	}
+	return exporters, files, nil
+}
+
+func loadImageFile(path string) (image.Image, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	img, _, err := image.Decode(file)
+	return img, err
+}
+
+// A conversion that's ready to be exported.
+type preparedConversion struct {
+	pmageFile PmageFile
+	inputs    []string
+	outputs   []Output
+	product   *Product
+	exporters []Exporter
+	files     [][]string
+}
+
+// Loads the job's pmage file and image and decides where each export goes.
+func (c *converter) prepare(job ConvertJob) (*preparedConversion, error) {
+	inputPath := job.InputPath
 	yamlPath := changeExt(inputPath, ".yaml")
-	var pmageFile PmageFile
-	if err := pmageFile.LoadYamlFile(c.Profile, yamlPath); err != nil {
-		return err
+	conv := &preparedConversion{}
+	if err := conv.pmageFile.LoadYamlFileWithLayers(c.Profile, job.Layers, yamlPath, job.Overrides); err != nil {
+		return nil, err
 	}
 
-	product := CreateProduct(c.Profile, &pmageFile)
-	inputImage, err := os.Open(inputPath)
+	conv.inputs = append([]string{inputPath}, conv.pmageFile.Files...)
+	var err error
+	conv.outputs, err = resolveOutputs(job.OutputPath, job.ExportTypes, conv.pmageFile.Outputs, conv.inputs)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer inputImage.Close()
-	img, _, err := image.Decode(inputImage)
+
+	conv.product = CreateProduct(c.Profile, &conv.pmageFile)
+	img, err := loadImageFile(inputPath)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if err := product.LoadImage(img); err != nil {
-		return err
+	if err := conv.product.LoadImage(img); err != nil {
+		return nil, err
 	}
 
-	var exporter Exporter
-	switch exportType {
-	case "ca65":
-		exporter = &Ca65Exporter{}
-	default:
-		return fmt.Errorf("Unknown export type \"%s\". Valid export types are [ca65]", exportType)
+	conv.exporters, conv.files, err = planExports(conv.product, conv.outputs, conv.inputs)
+	if err != nil {
+		return nil, err
 	}
+	return conv, nil
+}
 
-	if err := exporter.Export(product, outputPath); err != nil {
-		return err
+func (c *converter) Plan(job ConvertJob) ([]string, error) {
+	conv, err := c.prepare(job)
+	if err != nil {
+		return nil, err
 	}
+	return slices.Concat(conv.files...), nil
+}
 
-	return nil
+func (c *converter) Convert(job ConvertJob) (*ConvertResult, error) {
+	conv, err := c.prepare(job)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ConvertResult{
+		Dependencies: conv.inputs,
+		Missing:      conv.pmageFile.Missing,
+	}
+
+	// The product is shared by the exports, so the conversion and compression are only
+	// done once.
+	for i, output := range conv.outputs {
+		if manifest, ok := conv.exporters[i].(*JsonExporter); ok {
+			for j := range conv.outputs {
+				if j != i {
+					manifest.Outputs = append(manifest.Outputs, conv.files[j]...)
+				}
+			}
+		}
+
+		if err := conv.exporters[i].Export(conv.product, output.Path); err != nil {
+			return nil, err
+		}
+		result.Outputs = append(result.Outputs, conv.files[i]...)
+	}
+
+	return result, nil
 }
@@ -1,9 +1,107 @@
 package pmage
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func Test1(t *testing.T) {
 	//assert.NoError(t, Convert("test/gfx_ifont.png", ".testfile-foo.png"))
 }
+
+func TestResolveOutputs(t *testing.T) {
+	outputs, err := resolveOutputs("out/font.asm", []string{"ca65", "json", "wla", "ca65"},
+		[]Output{{Type: "preview"}, {Type: "preview", Path: "previews/font.png"}}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []Output{
+		{"ca65", "out/font.asm"},
+		{"json", "out/font.json"},
+		{"wla", "out/font.wla.asm"},
+		{"preview", "out/font.png"},
+		{"preview", "previews/font.png"},
+	}, outputs)
+
+	outputs, err = resolveOutputs("font.s", nil, nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []Output{{"ca65", "font.s"}}, outputs)
+
+	_, err = resolveOutputs("font.asm", []string{"ca65"}, []Output{{Type: "json", Path: "font.asm"}}, nil)
+	assert.ErrorIs(t, err, ErrInvalidOutput)
+
+	_, err = resolveOutputs("font.asm", []string{"gif"}, nil, nil)
+	assert.Error(t, err)
+
+	// Derived paths skip the inputs.
+	outputs, err = resolveOutputs("gfx/font.asm", []string{"ca65", "preview"}, nil, []string{"gfx/font.png"})
+	assert.NoError(t, err)
+	assert.Equal(t, []Output{{"ca65", "gfx/font.asm"}, {"preview", "gfx/font.preview.png"}}, outputs)
+
+	_, err = resolveOutputs("gfx/font.asm", nil, []Output{{Type: "preview", Path: "gfx/font.png"}}, []string{"gfx/font.png"})
+	assert.ErrorIs(t, err, ErrInvalidOutput)
+}
+
+func TestConvertMultipleExports(t *testing.T) {
+	dir := t.TempDir()
+	converter := NewConverter(&Profile{System: SystemSnes})
+	result, err := converter.Convert(ConvertJob{
+		InputPath:   "test/gfx_ifont.png",
+		OutputPath:  filepath.Join(dir, "font.asm"),
+		ExportTypes: []string{"ca65", "json", "preview"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "font.asm"), filepath.Join(dir, "font.inc"),
+		filepath.Join(dir, "font.json"), filepath.Join(dir, "font.png"),
+	}, result.Outputs)
+	assert.Equal(t, []string{"test/gfx_ifont.png", "test/gfx_ifont.yaml"}, result.Dependencies)
+
+	assert.FileExists(t, filepath.Join(dir, "font.asm"))
+	assert.FileExists(t, filepath.Join(dir, "font.inc"))
+	assert.FileExists(t, filepath.Join(dir, "font.json"))
+	assert.FileExists(t, filepath.Join(dir, "font.png"))
+
+	// The manifest lists the include too.
+	manifest, err := os.ReadFile(filepath.Join(dir, "font.json"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(manifest), "font.inc")
+
+	// Side files are outputs too, and the bin output path is only written for includes. A
+	// ca65 output that is itself a .inc file gets a .global.inc include.
+	for _, test := range []struct {
+		exportType string
+		outputPath string
+		outputs    []string
+	}{
+		{"c", "font.c", []string{"font.c", "font.h"}},
+		{"c", "font.h", []string{"font.h", "font.c"}},
+		{"bin", "font.bin", []string{"font.chr", "font.pal"}},
+		{"bin", "font.s", []string{"font.s", "font.chr", "font.pal"}},
+		{"ca65", "font.inc", []string{"font.inc", "font.global.inc"}},
+	} {
+		result, err = converter.Convert(ConvertJob{
+			InputPath:   "test/gfx_ifont.png",
+			OutputPath:  filepath.Join(dir, test.outputPath),
+			ExportTypes: []string{test.exportType},
+		})
+		assert.NoError(t, err)
+		outputs := []string{}
+		for _, output := range test.outputs {
+			outputs = append(outputs, filepath.Join(dir, output))
+		}
+		assert.Equal(t, outputs, result.Outputs)
+		for _, output := range outputs {
+			assert.FileExists(t, output)
+		}
+	}
+
+	// The ca65 include can't be written over another export's output.
+	_, err = converter.Convert(ConvertJob{
+		InputPath:   "test/gfx_ifont.png",
+		OutputPath:  filepath.Join(dir, "font.inc"),
+		ExportTypes: []string{"bin", "ca65"},
+	})
+	assert.ErrorIs(t, err, ErrInvalidOutput)
+}
@@ -0,0 +1,143 @@
+package pmage
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"strings"
+)
+
+// Options for turning console data back into an image, the reverse of a conversion.
+type DecodeOptions struct {
+	Bpp     int16
+	Packing PixelPacking // PixelPackingDefault uses the profile's.
+
+	// The tiles are laid out in rows of TilesPerRow. Untiled data can be decoded with 1x1
+	// tiles and TilesPerRow set to the image width.
+	TileWidth   int
+	TileHeight  int
+	TilesPerRow int
+
+	Compression PixelCompression // Of the pixel data.
+
+	// In the profile's color format. If nil, a grayscale ramp is used.
+	Palette []Color
+}
+
+const DefaultDecodeTilesPerRow = 16
+
+// Parses a pixel packing by name, e.g. "snes". Empty means the profile's default.
+func ParsePixelPacking(name string) (PixelPacking, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "default":
+		return PixelPackingDefault, nil
+	case "linear":
+		return PixelPackingLinear, nil
+	case "snes":
+		return PixelPackingSnes, nil
+	}
+	return PixelPackingDefault, fmt.Errorf("invalid pixel packing: %s", name)
+}
+
+// A ramp from black to white with a color for each pixel value.
+func grayscalePalette(bpp int16) []Color {
+	n := 1 << bpp
+	palette := make([]Color, n)
+	for i := range palette {
+		v := Color(i * 31 / (n - 1))
+		palette[i] = v | v<<5 | v<<10
+	}
+	return palette
+}
+
+// Decodes pixel data into an image. Tile slots after the last tile are transparent, as
+// are pixels with no palette entry.
+func DecodeImage(profile *Profile, data []byte, options DecodeOptions) (*image.NRGBA, error) {
+	if !profile.IsValidBpp(options.Bpp) {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidColors, options.Bpp)
+	}
+	format := profile.GetColorFormat()
+	if options.Bpp <= 8 {
+		format = indexedFormat(options.Bpp)
+	}
+
+	packing := options.Packing
+	if packing == PixelPackingDefault {
+		packing = profile.DefaultPixelPacking()
+	}
+
+	tw, th := options.TileWidth, options.TileHeight
+	if tw < 1 || th < 1 {
+		return nil, fmt.Errorf("%w: %dx%d", ErrInvalidTileSize, tw, th)
+	}
+	perRow := options.TilesPerRow
+	if perRow <= 0 {
+		perRow = DefaultDecodeTilesPerRow
+	}
+
+	data, err := Decompress(data, options.Compression)
+	if err != nil {
+		return nil, err
+	}
+	pixels, err := UnpackPixels(data, format, packing)
+	if err != nil {
+		return nil, err
+	}
+	if isSnesPlanar(format, packing) {
+		if tw%8 != 0 || th%8 != 0 {
+			return nil, fmt.Errorf("%w: SNES bitplanes need a multiple of 8x8 pixels, got %dx%d",
+				ErrInvalidTileSize, tw, th)
+		}
+		pixels = joinSnesTiles(pixels, tw)
+	}
+
+	numTiles := len(pixels) / (tw * th)
+	if numTiles == 0 {
+		return nil, fmt.Errorf("%w: not enough data for a %dx%d tile", ErrInvalidImage, tw, th)
+	}
+
+	palette := options.Palette
+	if palette == nil && format != ColorFormat15bgr {
+		palette = grayscalePalette(options.Bpp)
+	}
+	pixelColor := func(pixel Pixel) color.Color {
+		if format == ColorFormat15bgr {
+			return previewColor(Color(pixel))
+		}
+		if int(pixel) < len(palette) {
+			return previewColor(palette[pixel])
+		}
+		return color.NRGBA{}
+	}
+
+	rows := (numTiles + perRow - 1) / perRow
+	img := image.NewNRGBA(image.Rect(0, 0, perRow*tw, rows*th))
+	for t := 0; t < numTiles; t++ {
+		tile := pixels[t*tw*th : (t+1)*tw*th]
+		x, y := t%perRow*tw, t/perRow*th
+		for py := 0; py < th; py++ {
+			for px := 0; px < tw; px++ {
+				img.Set(x+px, y+py, pixelColor(tile[py*tw+px]))
+			}
+		}
+	}
+
+	return img, nil
+}
+
+// Decodes pixel data and writes the image to a PNG file.
+func DecodeToPng(profile *Profile, data []byte, options DecodeOptions, path string) error {
+	img, err := DecodeImage(profile, data, options)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return png.Encode(file, img)
+}
@@ -0,0 +1,136 @@
+package pmage
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnpackPixels(t *testing.T) {
+	// Two tiles, the second only two rows high.
+	pixels := []Pixel{}
+	for i := 0; i < 80; i++ {
+		pixels = append(pixels, Pixel(i*7%256))
+	}
+
+	for _, test := range []struct {
+		format  ColorFormat
+		packing PixelPacking
+		mask    Pixel
+	}{
+		{ColorFormatIndexed2, PixelPackingSnes, 3},
+		{ColorFormatIndexed2, PixelPackingLinear, 3},
+		{ColorFormatIndexed4, PixelPackingSnes, 15},
+		{ColorFormatIndexed4, PixelPackingLinear, 15},
+		{ColorFormatIndexed8, PixelPackingSnes, 255},
+		{ColorFormatIndexed8, PixelPackingLinear, 255},
+		{ColorFormat15bgr, PixelPackingSnes, 0x7FFF},
+	} {
+		source := make([]Pixel, len(pixels))
+		for i, pixel := range pixels {
+			source[i] = pixel & test.mask
+		}
+		unpacked, err := UnpackPixels(packPixels(source, test.format, test.packing), test.format, test.packing)
+		assert.NoError(t, err)
+		assert.Equal(t, source, unpacked, "format %d packing %d", test.format, test.packing)
+	}
+
+	// SNES 2bpp is one byte of each plane per row.
+	assert.Equal(t, []byte{0x81, 0x01}, packPixels([]Pixel{1, 0, 0, 0, 0, 0, 0, 3}, ColorFormatIndexed2, PixelPackingSnes))
+
+	// 4bpp and 8bpp store the planes in pairs, 16 bytes per pair for a whole tile.
+	tile := make([]Pixel, 64)
+	tile[0], tile[7] = 15, 5
+	expected := make([]byte, 32)
+	expected[0], expected[1], expected[16], expected[17] = 0x81, 0x80, 0x81, 0x80
+	assert.Equal(t, expected, packPixels(tile, ColorFormatIndexed4, PixelPackingSnes))
+
+	tile[0] = 255
+	expected = make([]byte, 64)
+	expected[0], expected[1], expected[16], expected[17] = 0x81, 0x80, 0x81, 0x80
+	expected[32], expected[33], expected[48], expected[49] = 0x80, 0x80, 0x80, 0x80
+	assert.Equal(t, expected, packPixels(tile, ColorFormatIndexed8, PixelPackingSnes))
+
+	palette, err := UnpackPalette([]byte{0xc0, 0x5d, 0xff, 0xff, 0x00}, ColorFormat15bgr)
+	assert.NoError(t, err)
+	assert.Equal(t, []Color{0x5dc0, 0x7fff}, palette)
+}
+
+func TestDecodeImage(t *testing.T) {
+	profile := &Profile{System: SystemSnes}
+	p := loadTestFontProduct(t, `
+colors: 4
+transparent: "0072BC"
+compression: lz2
+`)
+	data, _, err := p.CompressedPixelBytes()
+	assert.NoError(t, err)
+
+	img, err := DecodeImage(profile, data, DecodeOptions{
+		Bpp:         2,
+		TileWidth:   8,
+		TileHeight:  8,
+		TilesPerRow: p.TilesPerRow,
+		Compression: PixelCompressionLz2,
+		Palette:     p.Palette,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, p.TilesPerRow*8, img.Bounds().Dx())
+	assert.Equal(t, p.NumTiles()/p.TilesPerRow*8, img.Bounds().Dy())
+
+	// Every pixel matches the converted image.
+	checkPixels := func(p *Product, img *image.NRGBA) {
+		tw := int(p.Pmf.TileWidth)
+		for tile := 0; tile < p.NumTiles(); tile++ {
+			for i := 0; i < tw*tw; i++ {
+				x := tile%p.TilesPerRow*tw + i%tw
+				y := tile/p.TilesPerRow*tw + i/tw
+				expected := previewColor(p.Palette[p.Pixels[tile*tw*tw+i]])
+				if !assert.Equal(t, color.NRGBA(expected), img.NRGBAAt(x, y)) {
+					return
+				}
+			}
+		}
+	}
+	checkPixels(p, img)
+
+	// Tiles larger than 8x8 are made of 8x8 bitplane tiles.
+	p = loadTestFontProduct(t, `
+colors: 16
+tiles: 16x16
+transparent: "0072BC"
+`)
+	img, err = DecodeImage(profile, p.PixelBytes(), DecodeOptions{
+		Bpp:         4,
+		TileWidth:   16,
+		TileHeight:  16,
+		TilesPerRow: p.TilesPerRow,
+		Palette:     p.Palette,
+	})
+	assert.NoError(t, err)
+	checkPixels(p, img)
+	_, err = DecodeImage(profile, p.PixelBytes(), DecodeOptions{Bpp: 4, TileWidth: 12, TileHeight: 16})
+	assert.ErrorIs(t, err, ErrInvalidTileSize)
+	_, err = DecodeImage(profile, p.PixelBytes(), DecodeOptions{Bpp: 4, TileWidth: 12, TileHeight: 16,
+		Packing: PixelPackingLinear})
+	assert.NoError(t, err)
+
+	// Without a palette, a grayscale ramp is used, and empty tile slots are transparent.
+	img, err = DecodeImage(profile, []byte{0x81, 0x01, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+		DecodeOptions{Bpp: 2, TileWidth: 8, TileHeight: 8, TilesPerRow: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, 16, img.Bounds().Dx())
+	assert.Equal(t, color.NRGBA{0x52, 0x52, 0x52, 0xff}, img.NRGBAAt(0, 0))
+	assert.Equal(t, color.NRGBA{0, 0, 0, 0xff}, img.NRGBAAt(1, 0))
+	assert.Equal(t, color.NRGBA{0xff, 0xff, 0xff, 0xff}, img.NRGBAAt(7, 0))
+	assert.Equal(t, color.NRGBA{}, img.NRGBAAt(8, 0))
+
+	_, err = DecodeImage(profile, []byte{1, 2, 3}, DecodeOptions{Bpp: 2, TileWidth: 8, TileHeight: 8})
+	assert.ErrorIs(t, err, ErrInvalidImage)
+	_, err = DecodeImage(profile, data, DecodeOptions{Bpp: 3, TileWidth: 8, TileHeight: 8})
+	assert.ErrorIs(t, err, ErrInvalidColors)
+	_, err = DecodeImage(profile, []byte{0x10, 0xff}, DecodeOptions{Bpp: 2, TileWidth: 8, TileHeight: 8, Compression: PixelCompressionLz77})
+	assert.ErrorIs(t, err, ErrCorruptData)
+}
@@ -0,0 +1,50 @@
+package pmage
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Escapes a path for a make rule.
+func escapeMakePath(path string) string {
+	path = strings.ReplaceAll(path, "\\", "/")
+	path = strings.ReplaceAll(path, "$", "$$")
+	path = strings.ReplaceAll(path, "#", "\\#")
+	path = strings.ReplaceAll(path, " ", "\\ ")
+	return path
+}
+
+// Writes a make rule with the outputs depending on the dependencies, like gcc's -MD
+// option. Each dependency also gets an empty rule, like -MP, so deleting one doesn't
+// break the build.
+func WriteDepFile(w io.Writer, result *ConvertResult) error {
+	targets, deps := []string{}, []string{}
+	for _, output := range result.Outputs {
+		targets = append(targets, escapeMakePath(output))
+	}
+	for _, dep := range result.Dependencies {
+		deps = append(deps, escapeMakePath(dep))
+	}
+
+	_, err := fmt.Fprintf(w, "%s: %s\n", strings.Join(targets, " "), strings.Join(deps, " \\\n  "))
+	if err != nil {
+		return err
+	}
+	for _, dep := range deps {
+		if _, err = fmt.Fprintf(w, "\n%s:\n", dep); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func WriteDepFileToPath(path string, result *ConvertResult) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return WriteDepFile(f, result)
+}
@@ -0,0 +1,22 @@
+package pmage
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteDepFile(t *testing.T) {
+	var b strings.Builder
+	err := WriteDepFile(&b, &ConvertResult{
+		Outputs:      []string{"build/font.asm", "build/font.png"},
+		Dependencies: []string{"gfx/my font.png", "gfx/my font.yaml"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "build/font.asm build/font.png: gfx/my\\ font.png \\\n  gfx/my\\ font.yaml\n"+
+		"\ngfx/my\\ font.png:\n"+
+		"\ngfx/my\\ font.yaml:\n", b.String())
+
+	assert.Equal(t, "a$$b\\#c", escapeMakePath("a$b#c"))
+}
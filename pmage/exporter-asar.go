@@ -0,0 +1,73 @@
+package pmage
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// The asar exporter writes labels and db lists only. asar has no segments, so placement
+// is left to the including file (org, freespace, etc.), and the segment setting is
+// written as a comment for reference.
+type AsarExporter struct {
+	// See Ca65Exporter.Segment.
+	Segment string
+}
+
+func (e *AsarExporter) outputSection(w io.Writer, s *exportSection) error {
+	if s.chunkTable != nil {
+		if _, err := s.chunkTableBytes(); err != nil {
+			return err
+		}
+		_, err := fmt.Fprintf(w, "%s = %d\n%s:\n", s.symbol("num_chunks"), len(s.chunkTable)-1, s.symbol("chunks"))
+		if err != nil {
+			return err
+		}
+		if err = outputWords(w, "dw", s.chunkTable); err != nil {
+			return err
+		}
+	}
+
+	if _, err := fmt.Fprintf(w, "%s:\n", s.label); err != nil {
+		return err
+	}
+	if err := outputBytes(w, "db", s.data); err != nil {
+		return err
+	}
+
+	if s.requested == PixelCompressionAuto {
+		if _, err := fmt.Fprintf(w, "%s = %d\n", s.symbol("compression"), s.used); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (e *AsarExporter) Export(product *Product, path string) error {
+	sections, err := collectSections(product)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintf(f, "; EXPORTED WITH PMAGE\n"+
+		"; segment: %s\n"+
+		"\n", resolveSegment(e.Segment, product))
+	if err != nil {
+		return err
+	}
+
+	for i := range sections {
+		if err = e.outputSection(f, &sections[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
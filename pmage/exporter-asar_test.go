@@ -0,0 +1,28 @@
+package pmage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAsarExport(t *testing.T) {
+	p := loadTestFontProduct(t, `
+colors: 4
+transparent: "0072BC"
+chunk: 512
+`)
+
+	path := filepath.Join(t.TempDir(), "font.asm")
+	exporter := AsarExporter{}
+	assert.NoError(t, exporter.Export(p, path))
+
+	contents, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Contains(t, string(contents), "; segment: GRAPHICS\n")
+	assert.Contains(t, string(contents), "gfx_ifont_pixels_num_chunks = 3\n"+
+		"gfx_ifont_pixels_chunks:\n\tdw $0000,$0200,$0400,$0600\ngfx_ifont_pixels:\n\tdb $00,")
+	assert.Contains(t, string(contents), "gfx_ifont_palette:\n\tdb $c0,$5d,$ff,$7f,$00,$00,$00,$00\n")
+}
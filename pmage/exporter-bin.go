@@ -0,0 +1,219 @@
+package pmage
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The bin exporter writes each section to its own raw binary file, for build systems that
+// .incbin data instead of assembling large byte lists. The files are named after the
+// output path: .chr for the pixels, .pal for the palette and .map for the map. Chunk
+// offset tables are written to .chk as 16-bit words.
+//
+// The output file itself is an optional include, chosen by its extension:
+//
+//	.inc, .asm, .s  Assembler source with labels, incbin directives and size constants.
+//	.h              C header with size defines.
+//
+// For any other extension, only the binary files are written. The assembler include is
+// in ca65 syntax, or asar or WLA-DX syntax for the "bin-asar" and "bin-wla" export types.
+type BinExporter struct {
+	// Segment for the include, see Ca65Exporter.
+	Segment string
+
+	// The assembler syntax of the include: "ca65", "asar" or "wla". Defaults to ca65.
+	Assembler string
+}
+
+var binSectionExts = map[string]string{
+	"pixels":  ".chr",
+	"palette": ".pal",
+	"map":     ".map",
+}
+
+func (e *BinExporter) sectionPath(path string, s *exportSection) string {
+	return changeExt(path, binSectionExts[s.name])
+}
+
+// The parts of an include that differ between assemblers.
+type binIncludeSyntax struct {
+	header  string // Given the segment.
+	footer  string
+	declare func(symbols ...string) string
+	incbin  string // Given the file name.
+	define  func(name string, value int) string
+}
+
+var binIncludeSyntaxes = map[string]binIncludeSyntax{
+	"ca65": {
+		header: "; EXPORTED WITH PMAGE\n\t.segment \"%s\"\n",
+		declare: func(symbols ...string) string {
+			return "\t.global " + strings.Join(symbols, ", ") + "\n"
+		},
+		incbin: "\t.incbin \"%s\"\n",
+		define: func(name string, value int) string { return fmt.Sprintf("%s = %d\n", name, value) },
+	},
+	"asar": {
+		header:  "; EXPORTED WITH PMAGE\n; segment: %s\n",
+		declare: func(symbols ...string) string { return "" },
+		incbin:  "\tincbin \"%s\"\n",
+		define:  func(name string, value int) string { return fmt.Sprintf("%s = %d\n", name, value) },
+	},
+	"wla": {
+		header:  "; EXPORTED WITH PMAGE\n.SECTION \"%s\" FREE\n",
+		footer:  "\n.ENDS\n",
+		declare: func(symbols ...string) string { return "" },
+		incbin:  "\t.INCBIN \"%s\"\n",
+		define: func(name string, value int) string {
+			return fmt.Sprintf(".DEFINE %s %d\n.EXPORT %s\n", name, value, name)
+		},
+	},
+}
+
+func (e *BinExporter) writeAsmInclude(w io.Writer, path string, product *Product, sections []exportSection) error {
+	assembler := e.Assembler
+	if assembler == "" {
+		assembler = "ca65"
+	}
+	syntax, ok := binIncludeSyntaxes[assembler]
+	if !ok {
+		return fmt.Errorf("%w: no include syntax for assembler \"%s\"", ErrUnsupported, assembler)
+	}
+
+	if _, err := fmt.Fprintf(w, syntax.header, resolveSegment(e.Segment, product)); err != nil {
+		return err
+	}
+
+	for i := range sections {
+		s := &sections[i]
+		binPath := e.sectionPath(path, s)
+		size := s.symbol("size")
+		content := "\n" + syntax.declare(s.label, size) +
+			s.label + ":\n" + fmt.Sprintf(syntax.incbin, filepath.Base(binPath)) +
+			syntax.define(size, len(s.data))
+
+		if s.chunkTable != nil {
+			chunks, numChunks := s.symbol("chunks"), s.symbol("num_chunks")
+			content += syntax.declare(chunks, numChunks) +
+				chunks + ":\n" + fmt.Sprintf(syntax.incbin, filepath.Base(changeExt(binPath, ".chk"))) +
+				syntax.define(numChunks, len(s.chunkTable)-1)
+		}
+
+		if s.requested == PixelCompressionAuto {
+			compression := s.symbol("compression")
+			content += syntax.declare(compression) + syntax.define(compression, int(s.used))
+		}
+
+		if _, err := io.WriteString(w, content); err != nil {
+			return err
+		}
+	}
+
+	_, err := io.WriteString(w, syntax.footer)
+	return err
+}
+
+func (e *BinExporter) writeCHeader(w io.Writer, guard string, sections []exportSection) error {
+	_, err := fmt.Fprintf(w, "// EXPORTED WITH PMAGE\n#ifndef %s\n#define %s\n\n", guard, guard)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range sections {
+		if _, err = fmt.Fprintf(w, "#define %s %d\n", s.symbol("size"), len(s.data)); err != nil {
+			return err
+		}
+		if s.chunkTable != nil {
+			if _, err = fmt.Fprintf(w, "#define %s %d\n", s.symbol("num_chunks"), len(s.chunkTable)-1); err != nil {
+				return err
+			}
+		}
+		if s.requested == PixelCompressionAuto {
+			if _, err = fmt.Fprintf(w, "#define %s %d\n", s.symbol("compression"), s.used); err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err = fmt.Fprintf(w, "\n#endif\n")
+	return err
+}
+
+// Returns the kind of include written to the output path: "asm", "c", or empty if there
+// isn't one.
+func binIncludeType(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".inc", ".asm", ".s":
+		return "asm"
+	case ".h":
+		return "c"
+	}
+	return ""
+}
+
+// Only finds which sections are exported, so planning a conversion doesn't compress it.
+func (e *BinExporter) files(product *Product, path string) ([]string, error) {
+	files := []string{}
+	if binIncludeType(path) != "" {
+		files = append(files, path)
+	}
+	for _, name := range exportedSectionNames(product) {
+		binPath := changeExt(path, binSectionExts[name])
+		files = append(files, binPath)
+		// Only the pixels are chunked.
+		if name == "pixels" && product.Pmf.ChunkSize != 0 {
+			files = append(files, changeExt(binPath, ".chk"))
+		}
+	}
+	return files, nil
+}
+
+func (e *BinExporter) Export(product *Product, path string) error {
+	sections, err := collectSections(product)
+	if err != nil {
+		return err
+	}
+
+	for i := range sections {
+		s := &sections[i]
+		binPath := e.sectionPath(path, s)
+		if err = os.WriteFile(binPath, s.data, 0644); err != nil {
+			return err
+		}
+
+		if s.chunkTable != nil {
+			table, err := s.chunkTableBytes()
+			if err != nil {
+				return err
+			}
+			if err = os.WriteFile(changeExt(binPath, ".chk"), table, 0644); err != nil {
+				return err
+			}
+		}
+	}
+
+	var writeInclude func(w io.Writer) error
+	switch binIncludeType(path) {
+	case "asm":
+		writeInclude = func(w io.Writer) error {
+			return e.writeAsmInclude(w, path, product, sections)
+		}
+	case "c":
+		guard := "PMAGE_" + strings.ToUpper(formatLabel(product.Pmf.Name)) + "_H"
+		writeInclude = func(w io.Writer) error {
+			return e.writeCHeader(w, guard, sections)
+		}
+	default:
+		return nil
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return writeInclude(f)
+}
@@ -0,0 +1,84 @@
+package pmage
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBinExport(t *testing.T) {
+	pmage := `
+tiles: 8x8
+colors: 4
+transparent: "0072BC"
+compression: {pixels: lz2}
+chunk: row
+`
+	pmf, err := CreatePmageFileFromYamlString(&Profile{System: "snes"}, pmage, "gfx_ifont.yaml")
+	assert.NoError(t, err)
+
+	p := CreateProduct(&Profile{System: "snes"}, pmf)
+	assert.NoError(t, p.LoadImage(loadPng("test/gfx_ifont.png")))
+
+	dir := t.TempDir()
+	exporter := BinExporter{}
+
+	// Binaries only
+	assert.NoError(t, exporter.Export(p, filepath.Join(dir, "font.bin")))
+	assert.NoFileExists(t, filepath.Join(dir, "font.bin"))
+
+	palette, err := os.ReadFile(filepath.Join(dir, "font.pal"))
+	assert.NoError(t, err)
+	assert.Equal(t, p.PaletteBytes(), palette)
+
+	pixels, err := os.ReadFile(filepath.Join(dir, "font.chr"))
+	assert.NoError(t, err)
+	chunks, _, err := p.CompressedPixelChunks()
+	assert.NoError(t, err)
+
+	table, err := os.ReadFile(filepath.Join(dir, "font.chk"))
+	assert.NoError(t, err)
+	assert.Len(t, table, (len(chunks)+1)*2)
+	for i, chunk := range chunks {
+		start := int(table[i*2]) | int(table[i*2+1])<<8
+		assert.Equal(t, chunk, pixels[start:start+len(chunk)])
+	}
+
+	// With an include
+	assert.NoError(t, exporter.Export(p, filepath.Join(dir, "font.inc")))
+	include, err := os.ReadFile(filepath.Join(dir, "font.inc"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(include), "gfx_ifont_palette:\n\t.incbin \"font.pal\"\ngfx_ifont_palette_size = 8\n")
+	assert.Contains(t, string(include), "gfx_ifont_pixels_chunks:\n\t.incbin \"font.chk\"\n")
+
+	// Includes for other assemblers
+	exporter.Assembler = "asar"
+	assert.NoError(t, exporter.Export(p, filepath.Join(dir, "font.asm")))
+	include, err = os.ReadFile(filepath.Join(dir, "font.asm"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(include), "; segment: GRAPHICS\n")
+	assert.Contains(t, string(include), "\ngfx_ifont_palette:\n\tincbin \"font.pal\"\ngfx_ifont_palette_size = 8\n")
+	assert.NotContains(t, string(include), ".global")
+
+	exporter.Assembler = "wla"
+	assert.NoError(t, exporter.Export(p, filepath.Join(dir, "font.s")))
+	include, err = os.ReadFile(filepath.Join(dir, "font.s"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(include), ".SECTION \"GRAPHICS\" FREE\n")
+	assert.Contains(t, string(include), "gfx_ifont_palette:\n\t.INCBIN \"font.pal\"\n"+
+		".DEFINE gfx_ifont_palette_size 8\n.EXPORT gfx_ifont_palette_size\n")
+	assert.Contains(t, string(include), "gfx_ifont_pixels_chunks:\n\t.INCBIN \"font.chk\"\n")
+	assert.True(t, strings.HasSuffix(string(include), "\n.ENDS\n"))
+
+	exporter.Assembler = "bass"
+	assert.ErrorIs(t, exporter.Export(p, filepath.Join(dir, "font.inc")), ErrUnsupported)
+	exporter.Assembler = ""
+
+	assert.NoError(t, exporter.Export(p, filepath.Join(dir, "font.h")))
+	header, err := os.ReadFile(filepath.Join(dir, "font.h"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(header), "#define gfx_ifont_palette_size 8\n")
+}
@@ -0,0 +1,181 @@
+package pmage
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The C exporter writes a header with extern declarations and size defines, and a source
+// file with the data as const arrays. This mirrors the ca65 export for C projects like
+// devkitARM/devkitPro homebrew.
+//
+// The output path is the source file. The header is written next to it with a .h
+// extension.
+//
+// Pixel data is written as uint32_t and the palette and map as uint16_t, all 4-byte
+// aligned so they can be used with DMA and BIOS decompression directly. Arrays are
+// zero-padded to fit the element type; the _size defines hold the unpadded byte count.
+type CExporter struct{}
+
+func (e *CExporter) elemSize(s *exportSection) int {
+	if s.name == "pixels" {
+		return 4
+	}
+	return 2
+}
+
+func (e *CExporter) ctype(s *exportSection) string {
+	return fmt.Sprintf("uint%d_t", e.elemSize(s)*8)
+}
+
+func (e *CExporter) numElems(s *exportSection) int {
+	return (len(s.data) + e.elemSize(s) - 1) / e.elemSize(s)
+}
+
+// Writes the elements of an array initializer, 16 bytes' worth per line.
+func (e *CExporter) outputElems(w io.Writer, data []byte, elemSize int) error {
+	padded := make([]byte, (len(data)+elemSize-1)/elemSize*elemSize)
+	copy(padded, data)
+
+	perLine := 16 / elemSize
+	for i := 0; i < len(padded); i += perLine * elemSize {
+		elems := []string{}
+		for j := i; j < len(padded) && j < i+perLine*elemSize; j += elemSize {
+			value := uint32(0)
+			for k := elemSize - 1; k >= 0; k-- {
+				value = value<<8 | uint32(padded[j+k])
+			}
+			elems = append(elems, fmt.Sprintf("0x%0*x", elemSize*2, value))
+		}
+		if _, err := fmt.Fprintf(w, "\t%s,\n", strings.Join(elems, ",")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *CExporter) writeHeader(w io.Writer, guard string, sections []exportSection) error {
+	_, err := fmt.Fprintf(w, "// EXPORTED WITH PMAGE\n"+
+		"#ifndef %s\n"+
+		"#define %s\n"+
+		"\n"+
+		"#include <stdint.h>\n", guard, guard)
+	if err != nil {
+		return err
+	}
+
+	for i := range sections {
+		s := &sections[i]
+		if _, err = fmt.Fprintf(w, "\n#define %s %d\n", s.symbol("size"), len(s.data)); err != nil {
+			return err
+		}
+		if s.requested == PixelCompressionAuto {
+			if _, err = fmt.Fprintf(w, "#define %s %d\n", s.symbol("compression"), s.used); err != nil {
+				return err
+			}
+		}
+		if s.chunkTable != nil {
+			_, err = fmt.Fprintf(w, "#define %s %d\n"+
+				"extern const uint16_t %s[%d];\n",
+				s.symbol("num_chunks"), len(s.chunkTable)-1, s.symbol("chunks"), len(s.chunkTable))
+			if err != nil {
+				return err
+			}
+		}
+		_, err = fmt.Fprintf(w, "extern const %s %s[%d];\n", e.ctype(s), s.label, e.numElems(s))
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = fmt.Fprintf(w, "\n#endif\n")
+	return err
+}
+
+func (e *CExporter) writeSource(w io.Writer, header string, sections []exportSection) error {
+	_, err := fmt.Fprintf(w, "// EXPORTED WITH PMAGE\n#include \"%s\"\n", header)
+	if err != nil {
+		return err
+	}
+
+	for i := range sections {
+		s := &sections[i]
+		if s.chunkTable != nil {
+			table, err := s.chunkTableBytes()
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprintf(w, "\nconst uint16_t %s[%d] = {\n", s.symbol("chunks"), len(s.chunkTable))
+			if err != nil {
+				return err
+			}
+			if err = e.outputElems(w, table, 2); err != nil {
+				return err
+			}
+			if _, err = fmt.Fprintf(w, "};\n"); err != nil {
+				return err
+			}
+		}
+
+		_, err = fmt.Fprintf(w, "\nconst %s %s[%d] __attribute__((aligned(4))) = {\n",
+			e.ctype(s), s.label, e.numElems(s))
+		if err != nil {
+			return err
+		}
+		if err = e.outputElems(w, s.data, e.elemSize(s)); err != nil {
+			return err
+		}
+		if _, err = fmt.Fprintf(w, "};\n"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// The source is written to the output path, and the header next to it. If the output
+// path is a header, the source goes next to it instead.
+func cExportPaths(path string) (string, string) {
+	sourcePath := path
+	if strings.ToLower(filepath.Ext(path)) == ".h" {
+		sourcePath = changeExt(path, ".c")
+	}
+	return sourcePath, changeExt(sourcePath, ".h")
+}
+
+func (e *CExporter) files(product *Product, path string) ([]string, error) {
+	sourcePath, headerPath := cExportPaths(path)
+	if sourcePath == path {
+		return []string{sourcePath, headerPath}, nil
+	}
+	return []string{headerPath, sourcePath}, nil
+}
+
+func (e *CExporter) Export(product *Product, path string) error {
+	sections, err := collectSections(product)
+	if err != nil {
+		return err
+	}
+
+	sourcePath, headerPath := cExportPaths(path)
+	guard := "PMAGE_" + strings.ToUpper(formatLabel(product.Pmf.Name)) + "_H"
+
+	header, err := os.Create(headerPath)
+	if err != nil {
+		return err
+	}
+	defer header.Close()
+	if err = e.writeHeader(header, guard, sections); err != nil {
+		return err
+	}
+
+	source, err := os.Create(sourcePath)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	return e.writeSource(source, filepath.Base(headerPath), sections)
+}
@@ -0,0 +1,43 @@
+package pmage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCExport(t *testing.T) {
+	pmage := `
+tiles: 8x8
+colors: 4
+transparent: "0072BC"
+compression: {palette: lz2}
+`
+	pmf, err := CreatePmageFileFromYamlString(&Profile{System: "snes"}, pmage, "gfx/my-font.yaml")
+	assert.NoError(t, err)
+
+	p := CreateProduct(&Profile{System: "snes"}, pmf)
+	assert.NoError(t, p.LoadImage(loadPng("test/gfx_ifont.png")))
+
+	dir := t.TempDir()
+	exporter := CExporter{}
+	assert.NoError(t, exporter.Export(p, filepath.Join(dir, "font.c")))
+
+	header, err := os.ReadFile(filepath.Join(dir, "font.h"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(header), "#ifndef PMAGE_MY_FONT_H")
+	assert.Contains(t, string(header), "#define my_font_pixels_size 1536\n")
+	assert.Contains(t, string(header), "extern const uint32_t my_font_pixels[384];")
+
+	// The compressed palette is a copy command and a fill command.
+	assert.Contains(t, string(header), "#define my_font_palette_size 8\n")
+	assert.Contains(t, string(header), "extern const uint16_t my_font_palette[4];")
+
+	source, err := os.ReadFile(filepath.Join(dir, "font.c"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(source), "#include \"font.h\"")
+	assert.Contains(t, string(source), "const uint16_t my_font_palette[4] __attribute__((aligned(4))) = {\n"+
+		"\t0xc003,0xff5d,0x237f,0xff00,\n};")
+}
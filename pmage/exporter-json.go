@@ -0,0 +1,129 @@
+package pmage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// The JSON exporter writes a manifest describing the product for tools and build scripts:
+// dimensions, tiles, palette, map and the sections with their labels, sizes and
+// compression. It doesn't contain the data itself.
+type JsonExporter struct {
+	// Other files written by the conversion, listed in the manifest.
+	Outputs []string
+}
+
+type jsonManifest struct {
+	Name        string         `json:"name"`
+	Width       int            `json:"width"`
+	Height      int            `json:"height"`
+	Bpp         int16          `json:"bpp"`
+	TileWidth   int16          `json:"tile_width"`
+	TileHeight  int16          `json:"tile_height"`
+	NumTiles    int            `json:"num_tiles"`
+	TilesPerRow int            `json:"tiles_per_row"`
+	Palette     []jsonColor    `json:"palette"`
+	Map         []jsonMapEntry `json:"map"`
+	Sections    []jsonSection  `json:"sections"`
+	Outputs     []string       `json:"outputs"`
+}
+
+type jsonColor struct {
+	Source    string `json:"source"`    // RRGGBB, as in pmage files.
+	Converted int    `json:"converted"` // In the profile's color format.
+	Preview   string `json:"preview"`   // RRGGBB of the converted color.
+}
+
+type jsonMapEntry struct {
+	Tile     uint32 `json:"tile"`
+	Hflip    bool   `json:"hflip"`
+	Vflip    bool   `json:"vflip"`
+	Priority bool   `json:"priority"`
+}
+
+type jsonSection struct {
+	Name        string `json:"name"`
+	Label       string `json:"label"`
+	Size        int    `json:"size"`
+	RawSize     int    `json:"raw_size"`
+	Compression string `json:"compression"`
+	Chunks      []int  `json:"chunks,omitempty"` // Offsets of each chunk and the total size.
+}
+
+func (e *JsonExporter) manifest(product *Product) (*jsonManifest, error) {
+	sections, err := collectSections(product)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &jsonManifest{
+		Name:        formatLabel(product.Pmf.Name),
+		Width:       product.Width,
+		Height:      product.Height,
+		Bpp:         product.Pmf.Bpp,
+		TileWidth:   product.Pmf.TileWidth,
+		TileHeight:  product.Pmf.TileHeight,
+		TilesPerRow: product.TilesPerRow,
+		Palette:     []jsonColor{},
+		Map:         []jsonMapEntry{},
+		Sections:    []jsonSection{},
+		Outputs:     e.Outputs,
+	}
+	if m.Outputs == nil {
+		m.Outputs = []string{}
+	}
+
+	if product.TilesPerRow > 0 {
+		m.NumTiles = product.NumTiles()
+		tiles := max(len(product.Map), m.NumTiles)
+		m.Width = product.TilesPerRow * int(product.Pmf.TileWidth)
+		m.Height = (tiles + product.TilesPerRow - 1) / product.TilesPerRow * int(product.Pmf.TileHeight)
+	}
+
+	for i, c := range product.Palette {
+		color := jsonColor{Converted: int(c)}
+		if i < len(product.SourcePalette) {
+			s := product.SourcePalette[i]
+			color.Source = fmt.Sprintf("%02X%02X%02X", s&0xFF, s>>8&0xFF, s>>16&0xFF)
+		}
+		preview := previewColor(c)
+		color.Preview = fmt.Sprintf("%02X%02X%02X", preview.R, preview.G, preview.B)
+		m.Palette = append(m.Palette, color)
+	}
+
+	for _, entry := range product.Map {
+		m.Map = append(m.Map, jsonMapEntry{
+			Tile:     entry.Index,
+			Hflip:    entry.Flags&MapFlagHflip != 0,
+			Vflip:    entry.Flags&MapFlagVflip != 0,
+			Priority: entry.Flags&MapFlagPrio != 0,
+		})
+	}
+
+	for _, s := range sections {
+		m.Sections = append(m.Sections, jsonSection{
+			Name:        s.name,
+			Label:       s.label,
+			Size:        len(s.data),
+			RawSize:     s.rawSize,
+			Compression: s.used.String(),
+			Chunks:      s.chunkTable,
+		})
+	}
+
+	return m, nil
+}
+
+func (e *JsonExporter) Export(product *Product, path string) error {
+	m, err := e.manifest(product)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
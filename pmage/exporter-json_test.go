@@ -0,0 +1,56 @@
+package pmage
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJsonExport(t *testing.T) {
+	p := loadTestFontProduct(t, `
+colors: 4
+transparent: "0072BC"
+compression: {palette: auto}
+chunk: row
+`)
+
+	path := filepath.Join(t.TempDir(), "font.json")
+	exporter := JsonExporter{Outputs: []string{"font.asm", "font.inc"}}
+	assert.NoError(t, exporter.Export(p, path))
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	var m map[string]any
+	assert.NoError(t, json.Unmarshal(data, &m))
+
+	source := loadPng("test/gfx_ifont.png")
+	assert.Equal(t, "gfx_ifont", m["name"])
+	assert.Equal(t, float64(source.Bounds().Dx()), m["width"])
+	assert.Equal(t, float64(source.Bounds().Dy()), m["height"])
+	assert.Equal(t, float64(2), m["bpp"])
+	assert.Equal(t, float64(8), m["tile_width"])
+	assert.Equal(t, float64(96), m["num_tiles"])
+	assert.Equal(t, []any{"font.asm", "font.inc"}, m["outputs"])
+	assert.Equal(t, []any{}, m["map"])
+
+	palette := m["palette"].([]any)
+	assert.Len(t, palette, 4)
+	assert.Equal(t, map[string]any{"source": "0072BC", "converted": float64(0x5dc0), "preview": "0073BD"}, palette[0])
+	assert.Equal(t, "FFFFFF", palette[1].(map[string]any)["source"])
+
+	sections := m["sections"].([]any)
+	assert.Len(t, sections, 2)
+	pixels := sections[0].(map[string]any)
+	assert.Equal(t, "pixels", pixels["name"])
+	assert.Equal(t, "gfx_ifont_pixels", pixels["label"])
+	assert.Equal(t, "none", pixels["compression"])
+	assert.Len(t, pixels["chunks"], 7)
+
+	palSection := sections[1].(map[string]any)
+	assert.Equal(t, "gfx_ifont_palette", palSection["label"])
+	assert.Equal(t, float64(8), palSection["raw_size"])
+	assert.Equal(t, "none", palSection["compression"]) // Too small to compress.
+}
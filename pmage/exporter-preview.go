@@ -0,0 +1,153 @@
+package pmage
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+)
+
+// The preview exporter renders the product back into a PNG, so the converted result can
+// be checked without building anything. From top to bottom, it has the image rebuilt from
+// the map and tiles, the tileset with a grid between tiles, and the palette as swatches.
+// Colors are the converted ones, so quantization and merged colors are visible.
+type PreviewExporter struct{}
+
+const (
+	previewMargin      = 4
+	previewSwatchSize  = 8
+	previewSwatchesRow = 16
+	previewSheetRow    = 16 // Tiles per row in the sheet when the source layout is unknown.
+)
+
+var previewBackground = color.RGBA{0x20, 0x20, 0x20, 0xff}
+var previewGrid = color.RGBA{0x60, 0x60, 0x60, 0xff}
+
+// Expands a 15-bit color to 24-bit, copying the top bits into the new low bits so that
+// full intensity stays full.
+func previewColor(c Color) color.RGBA {
+	expand := func(v Color) uint8 {
+		v &= 31
+		return uint8(v<<3 | v>>2)
+	}
+	return color.RGBA{expand(c), expand(c >> 5), expand(c >> 10), 0xff}
+}
+
+// Returns the color of a pixel, looking up the palette for indexed formats.
+func (e *PreviewExporter) pixelColor(product *Product, pixel Pixel) color.RGBA {
+	if product.PixelFormat == ColorFormat15bgr {
+		return previewColor(Color(pixel))
+	}
+	if int(pixel) < len(product.Palette) {
+		return previewColor(product.Palette[pixel])
+	}
+	return color.RGBA{}
+}
+
+// Draws tile t at x, y, with the given flips.
+func (e *PreviewExporter) drawTile(img *image.RGBA, product *Product, t int, x, y int, flags MapFlags) {
+	tw, th := int(product.Pmf.TileWidth), int(product.Pmf.TileHeight)
+	tile := product.Pixels[t*tw*th : (t+1)*tw*th]
+	for py := 0; py < th; py++ {
+		for px := 0; px < tw; px++ {
+			sx, sy := px, py
+			if flags&MapFlagHflip != 0 {
+				sx = tw - 1 - px
+			}
+			if flags&MapFlagVflip != 0 {
+				sy = th - 1 - py
+			}
+			img.SetRGBA(x+px, y+py, e.pixelColor(product, tile[sy*tw+sx]))
+		}
+	}
+}
+
+// Returns the preview image without writing it.
+func (e *PreviewExporter) Render(product *Product) image.Image {
+	tiled := product.TilesPerRow > 0
+	tw, th := int(product.Pmf.TileWidth), int(product.Pmf.TileHeight)
+
+	// Without a map, the tiles are in the order of the image.
+	tileMap := product.Map
+	if tiled && len(tileMap) == 0 {
+		for t := 0; t < product.NumTiles(); t++ {
+			tileMap = append(tileMap, TileIndex{Index: uint32(t)})
+		}
+	}
+
+	imageWidth, imageHeight := product.Width, product.Height
+	sheetColumns, sheetWidth, sheetHeight := 0, 0, 0
+	if tiled {
+		imageWidth = product.TilesPerRow * tw
+		imageHeight = (len(tileMap) + product.TilesPerRow - 1) / product.TilesPerRow * th
+
+		sheetColumns = product.TilesPerRow
+		if len(product.Map) > 0 {
+			sheetColumns = previewSheetRow
+		}
+		sheetColumns = min(sheetColumns, product.NumTiles())
+		sheetRows := (product.NumTiles() + sheetColumns - 1) / sheetColumns
+		sheetWidth = sheetColumns*(tw+1) + 1
+		sheetHeight = sheetRows*(th+1) + 1
+	}
+
+	swatchColumns, paletteWidth, paletteHeight := 0, 0, 0
+	if len(product.Palette) > 0 {
+		swatchColumns = min(previewSwatchesRow, len(product.Palette))
+		swatchRows := (len(product.Palette) + swatchColumns - 1) / swatchColumns
+		paletteWidth = swatchColumns*(previewSwatchSize+1) + 1
+		paletteHeight = swatchRows*(previewSwatchSize+1) + 1
+	}
+
+	width := max(imageWidth, sheetWidth, paletteWidth) + previewMargin*2
+	height := imageHeight + sheetHeight + paletteHeight + previewMargin*4
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), &image.Uniform{previewBackground}, image.Point{}, draw.Src)
+
+	// Reconstructed image
+	top := previewMargin
+	if tiled {
+		for i, entry := range tileMap {
+			x := previewMargin + i%product.TilesPerRow*tw
+			y := top + i/product.TilesPerRow*th
+			e.drawTile(img, product, int(entry.Index), x, y, entry.Flags)
+		}
+	} else {
+		for i, pixel := range product.Pixels {
+			img.SetRGBA(previewMargin+i%product.Width, top+i/product.Width, e.pixelColor(product, pixel))
+		}
+	}
+	top += imageHeight + previewMargin
+
+	// Tileset
+	if tiled {
+		grid := image.Rect(previewMargin, top, previewMargin+sheetWidth, top+sheetHeight)
+		draw.Draw(img, grid, &image.Uniform{previewGrid}, image.Point{}, draw.Src)
+		for t := 0; t < product.NumTiles(); t++ {
+			x := previewMargin + 1 + t%sheetColumns*(tw+1)
+			y := top + 1 + t/sheetColumns*(th+1)
+			e.drawTile(img, product, t, x, y, 0)
+		}
+		top += sheetHeight + previewMargin
+	}
+
+	// Palette
+	for i, c := range product.Palette {
+		x := previewMargin + 1 + i%swatchColumns*(previewSwatchSize+1)
+		y := top + 1 + i/swatchColumns*(previewSwatchSize+1)
+		swatch := image.Rect(x, y, x+previewSwatchSize, y+previewSwatchSize)
+		draw.Draw(img, swatch, &image.Uniform{previewColor(c)}, image.Point{}, draw.Src)
+	}
+
+	return img
+}
+
+func (e *PreviewExporter) Export(product *Product, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return png.Encode(f, e.Render(product))
+}
@@ -0,0 +1,65 @@
+package pmage
+
+import (
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPreviewColor(t *testing.T) {
+	assert.Equal(t, color.RGBA{0xff, 0x00, 0x84, 0xff}, previewColor(0x1f|0x10<<10))
+	assert.Equal(t, color.RGBA{0x00, 0xff, 0x08, 0xff}, previewColor(0x1f<<5|0x01<<10))
+}
+
+func TestPreviewExport(t *testing.T) {
+	p := loadTestFontProduct(t, `
+colors: 4
+transparent: "0072BC"
+`)
+
+	path := filepath.Join(t.TempDir(), "font.png")
+	exporter := PreviewExporter{}
+	assert.NoError(t, exporter.Export(p, path))
+
+	f, err := os.Open(path)
+	assert.NoError(t, err)
+	defer f.Close()
+	img, err := png.Decode(f)
+	assert.NoError(t, err)
+
+	source := loadPng("test/gfx_ifont.png")
+	width, height := source.Bounds().Dx(), source.Bounds().Dy()
+	tiles := p.NumTiles()
+	sheetWidth, sheetHeight := p.TilesPerRow*9+1, (tiles/p.TilesPerRow)*9+1
+	assert.Equal(t, max(width, sheetWidth)+8, img.Bounds().Dx())
+	assert.Equal(t, height+sheetHeight+10+16, img.Bounds().Dy())
+
+	// The image is rebuilt with the converted colors. The transparent color 0072BC
+	// becomes 0073BD.
+	assert.Equal(t, color.RGBA{0x00, 0x73, 0xbd, 0xff}, img.At(4, 4))
+	for y := 0; y < height; y += 3 {
+		for x := 0; x < width; x += 3 {
+			r, g, b, _ := source.At(x, y).RGBA()
+			expected := previewColor(Color(r>>11 | (g>>11)<<5 | (b>>11)<<10))
+			if !assert.Equal(t, expected, img.At(x+4, y+4)) {
+				return
+			}
+		}
+	}
+
+	// Tile sheet grid, then the first tile.
+	top := 4 + height + 4
+	assert.Equal(t, previewGrid, img.At(4, top))
+	assert.Equal(t, img.At(4, 4), img.At(5, top+1))
+
+	// Palette swatches.
+	top += sheetHeight + 4
+	for i, c := range p.Palette {
+		assert.Equal(t, previewColor(c), img.At(5+i*9, top+1))
+		assert.Equal(t, previewBackground, img.At(5+i*9+8, top+1))
+	}
+}
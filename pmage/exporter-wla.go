@@ -0,0 +1,78 @@
+package pmage
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// The WLA-DX exporter writes the data into a free section named after the segment. It
+// doesn't select a bank or slot, so the file should be included after the project's
+// memory map and bank directives.
+type WlaExporter struct {
+	// Section name, see Ca65Exporter.Segment.
+	Segment string
+}
+
+func (e *WlaExporter) outputSection(w io.Writer, s *exportSection) error {
+	if s.chunkTable != nil {
+		if _, err := s.chunkTableBytes(); err != nil {
+			return err
+		}
+		numChunks := s.symbol("num_chunks")
+		_, err := fmt.Fprintf(w, ".DEFINE %s %d\n.EXPORT %s\n%s:\n",
+			numChunks, len(s.chunkTable)-1, numChunks, s.symbol("chunks"))
+		if err != nil {
+			return err
+		}
+		if err = outputWords(w, ".DW", s.chunkTable); err != nil {
+			return err
+		}
+	}
+
+	if _, err := fmt.Fprintf(w, "%s:\n", s.label); err != nil {
+		return err
+	}
+	if err := outputBytes(w, ".DB", s.data); err != nil {
+		return err
+	}
+
+	if s.requested == PixelCompressionAuto {
+		compression := s.symbol("compression")
+		_, err := fmt.Fprintf(w, ".DEFINE %s %d\n.EXPORT %s\n", compression, s.used, compression)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (e *WlaExporter) Export(product *Product, path string) error {
+	sections, err := collectSections(product)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintf(f, "; EXPORTED WITH PMAGE\n"+
+		".SECTION \"%s\" FREE\n"+
+		"\n", resolveSegment(e.Segment, product))
+	if err != nil {
+		return err
+	}
+
+	for i := range sections {
+		if err = e.outputSection(f, &sections[i]); err != nil {
+			return err
+		}
+	}
+
+	_, err = fmt.Fprintf(f, "\n.ENDS\n")
+	return err
+}
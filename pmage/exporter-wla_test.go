@@ -0,0 +1,39 @@
+package pmage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func loadTestFontProduct(t *testing.T, pmage string) *Product {
+	pmf, err := CreatePmageFileFromYamlString(&Profile{System: "snes"}, pmage, "gfx_ifont.yaml")
+	assert.NoError(t, err)
+
+	p := CreateProduct(&Profile{System: "snes"}, pmf)
+	assert.NoError(t, p.LoadImage(loadPng("test/gfx_ifont.png")))
+	return p
+}
+
+func TestWlaExport(t *testing.T) {
+	p := loadTestFontProduct(t, `
+colors: 16
+transparent: "0072BC"
+segment: FONT
+compression: {palette: auto}
+`)
+
+	path := filepath.Join(t.TempDir(), "font.asm")
+	exporter := WlaExporter{}
+	assert.NoError(t, exporter.Export(p, path))
+
+	contents, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Contains(t, string(contents), ".SECTION \"FONT\" FREE\n")
+	assert.Contains(t, string(contents), "gfx_ifont_pixels:\n\t.DB $00,")
+	assert.Contains(t, string(contents), "gfx_ifont_palette:\n\t.DB $03,$c0,$5d,$ff,$7f,$3b,$00,$ff\n")
+	assert.Contains(t, string(contents), ".DEFINE gfx_ifont_palette_compression 2\n.EXPORT gfx_ifont_palette_compression\n")
+	assert.Contains(t, string(contents), "\n.ENDS\n")
+}
@@ -1,11 +1,13 @@
 package pmage
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"os"
 	"path"
 	"regexp"
+	"slices"
 	"strings"
 )
 
@@ -16,30 +18,232 @@ type Exporter interface {
 	Export(product *Product, path string) error
 }
 
+// Implemented by exporters that write other files besides the output path, like an
+// include. They're reported with the outputs, and checked so that no export overwrites
+// another's files or an input.
+type multiFileExporter interface {
+	// Every file written for the output path, including the output path itself if it's
+	// written.
+	files(product *Product, path string) ([]string, error)
+}
+
+// Returns the files an export writes to the output path.
+func exportFiles(exporter Exporter, product *Product, path string) ([]string, error) {
+	if e, ok := exporter.(multiFileExporter); ok {
+		return e.files(product, path)
+	}
+	return []string{path}, nil
+}
+
+// The ca65 exporter writes the data to an assembly file, and a companion .inc file next to
+// it with .global declarations for the data and constants describing it, so code using
+// the data doesn't need to hardcode sizes.
 type Ca65Exporter struct {
 	// If this is not set, it will default to the pmf's segment
 	// If the pmf's segment is not set, it will default to the profile's default segment.
 	Segment string
 }
 
-func (e *Ca65Exporter) formatLabel(name string) string {
+// Derives a symbol name from the pmage file's name. The result is a valid identifier for
+// both assembly and C.
+func formatLabel(name string) string {
 	name = strings.ReplaceAll(name, "\\", "/")
 	name = path.Base(name)
 	if ext := path.Ext(name); ext != "" {
 		name = name[:len(name)-len(ext)]
 	}
 
-	var ca65InvalidLabelChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+	var invalidLabelChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
 	var startsWithDigit = regexp.MustCompile(`^[0-9]`)
 
-	name = ca65InvalidLabelChars.ReplaceAllString(name, "_")
+	name = invalidLabelChars.ReplaceAllString(name, "_")
 	if startsWithDigit.MatchString(name) {
 		name = "P" + name
 	}
 	return name
 }
 
-func (e *Ca65Exporter) outputBytes(w io.Writer, data []byte) error {
+// Exporters can override the segment. Otherwise, it comes from the pmf, and then the
+// profile's default segment.
+func resolveSegment(segment string, product *Product) string {
+	if segment == "" {
+		segment = product.Pmf.Segment
+		if segment == "" {
+			segment = product.Profile.DefaultSegment()
+		}
+	}
+	return segment
+}
+
+// A labeled block of data to export.
+type exportSection struct {
+	name      string // pixels, palette or map
+	label     string
+	data      []byte
+	requested PixelCompression // From the pmage file, may be auto.
+	used      PixelCompression
+	rawSize   int // Size before compression.
+
+	// For chunked data, the offset of each chunk, followed by the total size.
+	chunkTable []int
+
+	// Set when an exporter splits the data into multiple pieces.
+	numParts int
+
+	labels *LabelOptions
+}
+
+// Returns a symbol derived from the section's label, e.g. symbol("size").
+func (s *exportSection) symbol(suffix string) string {
+	return s.labels.Join(s.label, suffix)
+}
+
+// The names of the sections of the product that should be exported, in order.
+func exportedSectionNames(product *Product) []string {
+	names := []string{}
+	if product.Pmf.Create&CreateMaskPixels != 0 && len(product.Pixels) > 0 {
+		names = append(names, "pixels")
+	}
+	if product.Pmf.Create&CreateMaskPalette != 0 && len(product.Palette) > 0 {
+		names = append(names, "palette")
+	}
+	if product.Pmf.Create&CreateMaskMap != 0 && len(product.Map) > 0 {
+		names = append(names, "map")
+	}
+	return names
+}
+
+// Compresses the sections of the product that should be exported.
+func collectSections(product *Product) ([]exportSection, error) {
+	sections := []exportSection{}
+	names := exportedSectionNames(product)
+
+	if slices.Contains(names, "pixels") {
+		section := exportSection{
+			name:      "pixels",
+			requested: product.Pmf.Compression, rawSize: len(product.PixelBytes()),
+		}
+		if product.Pmf.ChunkSize != 0 {
+			chunks, compression, err := product.CompressedPixelChunks()
+			if err != nil {
+				return nil, err
+			}
+			offset := 0
+			for _, chunk := range chunks {
+				section.chunkTable = append(section.chunkTable, offset)
+				offset += len(chunk)
+			}
+			section.chunkTable = append(section.chunkTable, offset)
+			section.data, section.used = bytes.Join(chunks, nil), compression
+		} else {
+			data, compression, err := product.CompressedPixelBytes()
+			if err != nil {
+				return nil, err
+			}
+			section.data, section.used = data, compression
+		}
+		sections = append(sections, section)
+	}
+
+	if slices.Contains(names, "palette") {
+		data, compression, err := product.CompressedPaletteBytes()
+		if err != nil {
+			return nil, err
+		}
+		sections = append(sections, exportSection{
+			name: "palette", data: data,
+			requested: product.Pmf.PaletteCompression, used: compression,
+			rawSize: len(product.PaletteBytes()),
+		})
+	}
+
+	if slices.Contains(names, "map") {
+		data, compression, err := product.CompressedMapBytes()
+		if err != nil {
+			return nil, err
+		}
+		sections = append(sections, exportSection{
+			name: "map", data: data,
+			requested: product.Pmf.MapCompression, used: compression,
+			rawSize: len(product.MapBytes()),
+		})
+	}
+
+	// Catch templates that give different sections the same symbol.
+	labels := map[string]string{}
+	for i := range sections {
+		s := &sections[i]
+		label, err := product.Pmf.Labels.Format(product.Pmf.Name, s.name)
+		if err != nil {
+			return nil, err
+		}
+		if other, ok := labels[label]; ok {
+			return nil, fmt.Errorf("%w: %s and %s are both labeled %s", ErrInvalidLabels, other, s.name, label)
+		}
+		labels[label] = s.name
+		s.label, s.labels = label, &product.Pmf.Labels
+	}
+	if err := checkDerivedSymbols(sections); err != nil {
+		return nil, err
+	}
+
+	return sections, nil
+}
+
+// The suffixes of the symbols that exporters derive from a section's label. Data split
+// into parts also gets a symbol for each part, numbered from 0.
+var derivedSymbols = []string{"size", "raw_size", "compression", "chunks", "num_chunks", "parts", "num_parts", "part_sizes"}
+
+// Catches section labels that clash with a symbol derived from another section, e.g. a
+// pixels label that's the same as the palette's size.
+func checkDerivedSymbols(sections []exportSection) error {
+	type symbol struct{ name, section, what string }
+	symbols := []symbol{}
+	for _, s := range sections {
+		symbols = append(symbols, symbol{s.label, s.name, s.name})
+		for _, suffix := range derivedSymbols {
+			symbols = append(symbols, symbol{s.symbol(suffix), s.name, s.name + " " + suffix})
+		}
+	}
+
+	for i, a := range symbols {
+		for _, b := range symbols[i+1:] {
+			if a.name == b.name && a.section != b.section {
+				return fmt.Errorf("%w: %s and %s are both named %s", ErrInvalidLabels, a.what, b.what, a.name)
+			}
+		}
+	}
+	for _, s := range sections {
+		partPrefix := strings.TrimSuffix(s.symbol("0"), "0")
+		for _, other := range symbols {
+			number := strings.TrimPrefix(other.name, partPrefix)
+			if other.section != s.name && number != other.name && isDigits(number) {
+				return fmt.Errorf("%w: %s and %s part %s are both named %s",
+					ErrInvalidLabels, other.what, s.name, number, other.name)
+			}
+		}
+	}
+	return nil
+}
+
+func isDigits(s string) bool {
+	return s != "" && strings.Trim(s, "0123456789") == ""
+}
+
+// Chunk offsets are stored as 16-bit words.
+func (s *exportSection) chunkTableBytes() ([]byte, error) {
+	if s.chunkTable[len(s.chunkTable)-1] > 0xFFFF {
+		return nil, fmt.Errorf("%w: chunked data for %s is larger than 64KB", ErrUnsupported, s.label)
+	}
+	table := make([]byte, len(s.chunkTable)*2)
+	for i, offset := range s.chunkTable {
+		table[i*2], table[i*2+1] = byte(offset), byte(offset>>8)
+	}
+	return table, nil
+}
+
+// Writes data as assembler byte lists, using the given directive (e.g. ".byte").
+func outputBytes(w io.Writer, directive string, data []byte) error {
 
 	for i := 0; i < len(data); i += 128 {
 		sliceEnd := i + 128
@@ -48,7 +252,7 @@ func (e *Ca65Exporter) outputBytes(w io.Writer, data []byte) error {
 		}
 		slice := data[i:sliceEnd]
 
-		content := "\t.byte "
+		content := "\t" + directive + " "
 		for j, b := range slice {
 			if j > 0 {
 				content += ","
@@ -64,7 +268,217 @@ func (e *Ca65Exporter) outputBytes(w io.Writer, data []byte) error {
 	return nil
 }
 
+// Writes values as assembler word lists, using the given directive (e.g. ".word").
+func outputWords(w io.Writer, directive string, values []int) error {
+	for i := 0; i < len(values); i += 16 {
+		words := []string{}
+		for _, value := range values[i:min(i+16, len(values))] {
+			words = append(words, fmt.Sprintf("$%04x", value))
+		}
+		if _, err := fmt.Fprintf(w, "\t%s %s\n", directive, strings.Join(words, ",")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Writes a labeled block of data. If the compression was chosen automatically, the
+// format is also exported as <label>_compression. Chunked data is preceded by
+// <label>_chunks, a table of .word offsets from <label> to the start of each chunk, with
+// an extra entry at the end for the total size. The number of chunks is exported as
+// <label>_num_chunks.
+func (e *Ca65Exporter) outputSection(w io.Writer, s *exportSection) error {
+	if s.chunkTable != nil {
+		if _, err := s.chunkTableBytes(); err != nil {
+			return err
+		}
+		numChunks, chunks := s.symbol("num_chunks"), s.symbol("chunks")
+		_, err := fmt.Fprintf(w, "\t.global %s\n%s = %d\n", numChunks, numChunks, len(s.chunkTable)-1)
+		if err != nil {
+			return err
+		}
+		if _, err = fmt.Fprintf(w, "\t.global %s\n%s:\n", chunks, chunks); err != nil {
+			return err
+		}
+		if err = outputWords(w, ".word", s.chunkTable); err != nil {
+			return err
+		}
+	}
+
+	if _, err := fmt.Fprintf(w, "\t.global %s\n%s:\n", s.label, s.label); err != nil {
+		return err
+	}
+	if err := outputBytes(w, ".byte", s.data); err != nil {
+		return err
+	}
+
+	if s.requested == PixelCompressionAuto {
+		// Let the runtime know which decompressor to use.
+		label := s.symbol("compression")
+		if _, err := fmt.Fprintf(w, "\t.global %s\n%s = %d\n", label, label, s.used); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Tracks how much of the current bank is used while writing to a list of segments.
+type ca65BankWriter struct {
+	w        io.Writer
+	segments []string
+	bankSize int
+	align    int
+	index    int
+	offset   int
+}
+
+func (b *ca65BankWriter) alignedOffset() int {
+	return (b.offset + b.align - 1) / b.align * b.align
+}
+
+func (b *ca65BankWriter) fits(size int) bool {
+	return b.alignedOffset()+size <= b.bankSize
+}
+
+func (b *ca65BankWriter) nextSegment() error {
+	b.index++
+	if b.index >= len(b.segments) {
+		return fmt.Errorf("%w: data doesn't fit in segments [%s] with bank size %d",
+			ErrConversion, strings.Join(b.segments, ", "), b.bankSize)
+	}
+	b.offset = 0
+	_, err := fmt.Fprintf(b.w, "\n\t.segment \"%s\"\n", b.segments[b.index])
+	return err
+}
+
+// Starts a block of data at the next aligned position.
+func (b *ca65BankWriter) startAligned() error {
+	if b.align > 1 {
+		if _, err := fmt.Fprintf(b.w, "\t.align %d\n", b.align); err != nil {
+			return err
+		}
+	}
+	b.offset = b.alignedOffset()
+	return nil
+}
+
+// Writes a section into the banks. If it doesn't fit in the rest of the current bank, it
+// moves to the next one. Data too large for a bank is split into pieces labeled
+// <label>_0, <label>_1, etc. with <label> on the first one. <label>_parts is a table of
+// .faraddr pointers to the pieces, <label>_part_sizes has their sizes, and the number of
+// pieces is exported as <label>_num_parts.
+func (e *Ca65Exporter) outputBankedSection(b *ca65BankWriter, s *exportSection) error {
+	size := len(s.data)
+	if s.chunkTable != nil {
+		// Chunk offsets are relative to the label, so chunked data can't be split.
+		size += len(s.chunkTable) * 2
+		if size > b.bankSize {
+			return fmt.Errorf("%w: chunked data for %s is larger than a bank", ErrConversion, s.label)
+		}
+	}
+
+	if !b.fits(size) && size <= b.bankSize {
+		if err := b.nextSegment(); err != nil {
+			return err
+		}
+	}
+
+	if b.fits(size) {
+		if err := b.startAligned(); err != nil {
+			return err
+		}
+		b.offset += size
+		return e.outputSection(b.w, s)
+	}
+
+	partSizes := []int{}
+	for remaining := s.data; len(remaining) > 0; {
+		if !b.fits(1) {
+			if err := b.nextSegment(); err != nil {
+				return err
+			}
+		}
+		if err := b.startAligned(); err != nil {
+			return err
+		}
+
+		n := min(b.bankSize-b.offset, len(remaining))
+		label := s.symbol(fmt.Sprint(len(partSizes)))
+		if len(partSizes) == 0 {
+			if _, err := fmt.Fprintf(b.w, "\t.global %s\n%s:\n", s.label, s.label); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(b.w, "\t.global %s\n%s:\n", label, label); err != nil {
+			return err
+		}
+		if err := outputBytes(b.w, ".byte", remaining[:n]); err != nil {
+			return err
+		}
+
+		b.offset += n
+		partSizes = append(partSizes, n)
+		remaining = remaining[n:]
+	}
+	s.numParts = len(partSizes)
+
+	// The tables are small enough to go anywhere.
+	if !b.fits(len(partSizes) * 5) {
+		if err := b.nextSegment(); err != nil {
+			return err
+		}
+	}
+	b.offset += len(partSizes) * 5
+
+	parts := []string{}
+	for i := range partSizes {
+		parts = append(parts, s.symbol(fmt.Sprint(i)))
+	}
+	numParts, partsLabel, partSizesLabel := s.symbol("num_parts"), s.symbol("parts"), s.symbol("part_sizes")
+	_, err := fmt.Fprintf(b.w, "\t.global %s\n%s = %d\n"+
+		"\t.global %s\n%s:\n\t.faraddr %s\n"+
+		"\t.global %s\n%s:\n",
+		numParts, numParts, len(parts),
+		partsLabel, partsLabel, strings.Join(parts, ","),
+		partSizesLabel, partSizesLabel)
+	if err != nil {
+		return err
+	}
+	if err = outputWords(b.w, ".word", partSizes); err != nil {
+		return err
+	}
+
+	if s.requested == PixelCompressionAuto {
+		label := s.symbol("compression")
+		if _, err := fmt.Fprintf(b.w, "\t.global %s\n%s = %d\n", label, label, s.used); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// The companion include is next to the output, with a .inc extension. If the output is
+// already a .inc file, the include is named e.g. font.global.inc instead.
+func ca65IncludePath(path string) string {
+	includePath := changeExt(path, ".inc")
+	if includePath == path {
+		includePath = changeExt(path, ".global.inc")
+	}
+	return includePath
+}
+
+func (e *Ca65Exporter) files(product *Product, path string) ([]string, error) {
+	return []string{path, ca65IncludePath(path)}, nil
+}
+
 func (e *Ca65Exporter) Export(product *Product, path string) error {
+	sections, err := collectSections(product)
+	if err != nil {
+		return err
+	}
+
 	f, err := os.Create(path)
 	if err != nil {
 		return err
@@ -72,45 +486,114 @@ func (e *Ca65Exporter) Export(product *Product, path string) error {
 
 	defer f.Close()
 
-	segment := e.Segment
-	if segment == "" {
-		segment = product.Pmf.Segment
-		if segment == "" {
-			segment = product.Profile.DefaultSegment()
-		}
+	segments := []string{resolveSegment(e.Segment, product)}
+	if e.Segment == "" && len(product.Pmf.Segments) > 0 {
+		segments = product.Pmf.Segments
 	}
 
 	_, err = fmt.Fprintf(f, "; EXPORTED WITH PMAGE\n"+
 		"\t.segment \"%s\"\n"+
-		"\n", segment)
+		"\n", segments[0])
+	if err != nil {
+		return err
+	}
+
+	if len(product.Pmf.Segments) > 0 {
+		banks := &ca65BankWriter{
+			w:        f,
+			segments: segments,
+			bankSize: product.Pmf.BankSize,
+			align:    product.Pmf.Align,
+		}
+		for i := range sections {
+			if err = e.outputBankedSection(banks, &sections[i]); err != nil {
+				return err
+			}
+		}
+	} else {
+		for i := range sections {
+			if err = e.outputSection(f, &sections[i]); err != nil {
+				return err
+			}
+		}
+	}
+
+	include, err := os.Create(ca65IncludePath(path))
 	if err != nil {
 		return err
 	}
+	defer include.Close()
 
-	labelBase := e.formatLabel(product.Pmf.Name)
+	return e.outputInclude(include, product, sections)
+}
 
-	if product.Pmf.Create&CreateMaskPixels != 0 && len(product.Pixels) > 0 {
-		label := fmt.Sprintf("%s_pixels", labelBase)
-		data := product.PixelBytes()
-		if _, err = fmt.Fprintf(f, "\t.global %s\n%s:\n", label, label); err != nil {
+// Writes the companion include file. Sizes are in bytes; <label>_size is the size of the
+// exported data and <label>_raw_size is the size after decompression.
+func (e *Ca65Exporter) outputInclude(w io.Writer, product *Product, sections []exportSection) error {
+	guard := strings.ToUpper(formatLabel(product.Pmf.Name)) + "_INC"
+
+	_, err := fmt.Fprintf(w, "; EXPORTED WITH PMAGE\n"+
+		".ifndef %s\n"+
+		"%s = 1\n"+
+		"\n", guard, guard)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range sections {
+		if _, err = fmt.Fprintf(w, "\t.global %s\n", s.label); err != nil {
 			return err
 		}
-		if err = e.outputBytes(f, data); err != nil {
-			return err
+		if s.chunkTable != nil {
+			if _, err = fmt.Fprintf(w, "\t.global %s\n", s.symbol("chunks")); err != nil {
+				return err
+			}
+		}
+		if s.numParts > 0 {
+			_, err = fmt.Fprintf(w, "\t.global %s, %s\n", s.symbol("parts"), s.symbol("part_sizes"))
+			if err != nil {
+				return err
+			}
 		}
 	}
 
-	if product.Pmf.Create&CreateMaskPalette != 0 && len(product.Palette) > 0 {
-		label := fmt.Sprintf("%s_palette", labelBase)
-		data := product.PaletteBytes()
-		if _, err := fmt.Fprintf(f, "\t.global %s\n%s:\n", label, label); err != nil {
+	constants := [][2]any{}
+	for _, c := range [][2]any{
+		{"bpp", product.Pmf.Bpp},
+		{"tile_width", product.Pmf.TileWidth},
+		{"tile_height", product.Pmf.TileHeight},
+		{"num_tiles", product.NumTiles()},
+		{"num_colors", len(product.Palette)},
+	} {
+		label, err := product.Pmf.Labels.Format(product.Pmf.Name, c[0].(string))
+		if err != nil {
 			return err
 		}
+		constants = append(constants, [2]any{label, c[1]})
+	}
+	for _, s := range sections {
+		constants = append(constants,
+			[2]any{s.symbol("size"), len(s.data)},
+			[2]any{s.symbol("raw_size"), s.rawSize},
+			[2]any{s.symbol("compression"), int(s.used)},
+		)
+		if s.chunkTable != nil {
+			constants = append(constants, [2]any{s.symbol("num_chunks"), len(s.chunkTable) - 1})
+		}
+		if s.numParts > 0 {
+			constants = append(constants, [2]any{s.symbol("num_parts"), s.numParts})
+		}
+	}
 
-		if err := e.outputBytes(f, data); err != nil {
+	if _, err = fmt.Fprintln(w); err != nil {
+		return err
+	}
+	for _, c := range constants {
+		if _, err = fmt.Fprintf(w, "%s = %d\n", c[0], c[1]); err != nil {
 			return err
 		}
 	}
 
-	return nil
+	_, err = fmt.Fprintf(w, "\n.endif\n")
+	return err
 }
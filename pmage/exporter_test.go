@@ -0,0 +1,94 @@
+package pmage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCa65Include(t *testing.T) {
+	p := loadTestFontProduct(t, `
+tiles: 8x8
+colors: 16
+compression: {pixels: auto}
+chunk: row
+`)
+
+	dir := t.TempDir()
+	exporter := Ca65Exporter{}
+	assert.NoError(t, exporter.Export(p, filepath.Join(dir, "font.asm")))
+
+	contents, err := os.ReadFile(filepath.Join(dir, "font.inc"))
+	assert.NoError(t, err)
+	include := string(contents)
+
+	chunks, compression, err := p.CompressedPixelChunks()
+	assert.NoError(t, err)
+	size := 0
+	for _, chunk := range chunks {
+		size += len(chunk)
+	}
+
+	assert.Contains(t, include, ".ifndef GFX_IFONT_INC\n")
+	assert.Contains(t, include, "\t.global gfx_ifont_pixels\n\t.global gfx_ifont_pixels_chunks\n\t.global gfx_ifont_palette\n")
+	assert.Contains(t, include, "gfx_ifont_bpp = 4\n")
+	assert.Contains(t, include, "gfx_ifont_tile_width = 8\ngfx_ifont_tile_height = 8\n")
+	assert.Contains(t, include, "gfx_ifont_num_tiles = 96\n")
+	assert.Contains(t, include, "gfx_ifont_num_colors = 16\n")
+	assert.Contains(t, include, fmt.Sprintf("gfx_ifont_pixels_size = %d\n", size))
+	assert.Contains(t, include, "gfx_ifont_pixels_raw_size = 3072\n")
+	assert.Contains(t, include, fmt.Sprintf("gfx_ifont_pixels_compression = %d\n", compression))
+	assert.Contains(t, include, "gfx_ifont_pixels_num_chunks = 6\n")
+	assert.Contains(t, include, "gfx_ifont_palette_size = 32\n")
+	assert.Contains(t, include, "\n.endif\n")
+}
+
+func TestCa65Banks(t *testing.T) {
+	p := loadTestFontProduct(t, `
+colors: 16
+segments: GFX1 GFX2 GFX3 GFX4
+bank_size: 1024
+align: 256
+`)
+
+	path := filepath.Join(t.TempDir(), "font.asm")
+	exporter := Ca65Exporter{}
+	assert.NoError(t, exporter.Export(p, path))
+
+	contents, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	output := string(contents)
+
+	assert.Contains(t, output, "\t.segment \"GFX1\"\n\n\t.align 256\n"+
+		"\t.global gfx_ifont_pixels\ngfx_ifont_pixels:\n\t.global gfx_ifont_pixels_0\ngfx_ifont_pixels_0:\n")
+	assert.Contains(t, output, "\n\t.segment \"GFX2\"\n\t.align 256\n\t.global gfx_ifont_pixels_1\n")
+	assert.Contains(t, output, "\n\t.segment \"GFX3\"\n\t.align 256\n\t.global gfx_ifont_pixels_2\n")
+	assert.Contains(t, output, "\n\t.segment \"GFX4\"\n\t.global gfx_ifont_pixels_num_parts\ngfx_ifont_pixels_num_parts = 3\n"+
+		"\t.global gfx_ifont_pixels_parts\ngfx_ifont_pixels_parts:\n"+
+		"\t.faraddr gfx_ifont_pixels_0,gfx_ifont_pixels_1,gfx_ifont_pixels_2\n"+
+		"\t.global gfx_ifont_pixels_part_sizes\ngfx_ifont_pixels_part_sizes:\n\t.word $0400,$0400,$0400\n")
+	assert.Contains(t, output, "\t.align 256\n\t.global gfx_ifont_palette\n")
+
+	contents, err = os.ReadFile(filepath.Join(filepath.Dir(path), "font.inc"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(contents), "\t.global gfx_ifont_pixels_parts, gfx_ifont_pixels_part_sizes\n")
+	assert.Contains(t, string(contents), "gfx_ifont_pixels_num_parts = 3\n")
+
+	// Not enough room.
+	p.Pmf.Segments = []string{"GFX1", "GFX2"}
+	assert.ErrorIs(t, exporter.Export(p, path), ErrConversion)
+}
+
+func TestBankOptions(t *testing.T) {
+	pmf, err := CreatePmageFileFromYamlString(&Profile{System: "snes"}, "segments: A B", "test.yaml")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"A", "B"}, pmf.Segments)
+	assert.Equal(t, 0x8000, pmf.BankSize)
+	assert.Equal(t, 1, pmf.Align)
+
+	_, err = CreatePmageFileFromYamlString(&Profile{System: "snes"}, "segments: A\nalign: 3", "test.yaml")
+	assert.ErrorIs(t, err, ErrInvalidBanking)
+}
@@ -0,0 +1,261 @@
+package pmage
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// A report on how an image converts, for checking pmage file settings and budgeting
+// memory without writing any outputs.
+type InfoReport struct {
+	InputPath string
+	Options   *PmageFile
+	Product   *Product
+
+	// Why the conversion failed, if it did. The report is still filled in as far as the
+	// conversion got, e.g. the colors are counted even if there are too many.
+	Err error
+
+	Width  int
+	Height int
+
+	SourceColors int // Unique colors in the image, including alpha.
+	Colors       int // Unique colors after converting to the profile's color format.
+
+	// Zero when the image isn't tiled.
+	Tiles              int
+	UniqueTiles        int
+	UniqueFlippedTiles int // Unique when tiles that are flips of each other count as one.
+
+	Sections []InfoSection
+}
+
+// The size of a section of the output.
+type InfoSection struct {
+	Name           string
+	Size           int // Before compression.
+	CompressedSize int
+	Compression    PixelCompression // The scheme used, which "auto" resolves to.
+}
+
+// Loads an image and its options and converts it like the converter, but only reports
+// on the result. The error is for problems with the inputs, like an invalid pmage file.
+// Conversion errors are in the report.
+func Inspect(profile *Profile, job ConvertJob) (*InfoReport, error) {
+	var pmageFile PmageFile
+	yamlPath := changeExt(job.InputPath, ".yaml")
+	if err := pmageFile.LoadYamlFileWithLayers(profile, job.Layers, yamlPath, job.Overrides); err != nil {
+		return nil, err
+	}
+	img, err := loadImageFile(job.InputPath)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &InfoReport{
+		InputPath: job.InputPath,
+		Options:   &pmageFile,
+		Product:   CreateProduct(profile, &pmageFile),
+		Width:     img.Bounds().Dx(),
+		Height:    img.Bounds().Dy(),
+	}
+
+	sourceColors := map[Color]bool{}
+	colors := map[Color]bool{}
+	for y := img.Bounds().Min.Y; y < img.Bounds().Max.Y; y++ {
+		for x := img.Bounds().Min.X; x < img.Bounds().Max.X; x++ {
+			r, g, b, a := img.At(x, y).RGBA()
+			color := Color(r>>8 | (g>>8)<<8 | (b>>8)<<16 | (a>>8)<<24)
+			sourceColors[color] = true
+			converted := []Color{color}
+			convertColors(converted, profile.GetColorFormat())
+			colors[converted[0]] = true
+		}
+	}
+	report.SourceColors, report.Colors = len(sourceColors), len(colors)
+
+	report.Err = report.Product.LoadImage(img)
+	report.countTiles()
+	if report.Err == nil {
+		report.Err = report.addSections()
+	}
+	return report, nil
+}
+
+// Counts the tiles in the product, which are cut out before the palette is made, so they
+// can be counted even if there are too many colors.
+func (r *InfoReport) countTiles() {
+	p := r.Product
+	if p.TilesPerRow == 0 {
+		return
+	}
+
+	tw, th := int(p.Pmf.TileWidth), int(p.Pmf.TileHeight)
+	key := func(tile []Pixel, hflip, vflip bool) string {
+		var sb strings.Builder
+		for y := 0; y < th; y++ {
+			for x := 0; x < tw; x++ {
+				sx, sy := x, y
+				if hflip {
+					sx = tw - 1 - x
+				}
+				if vflip {
+					sy = th - 1 - y
+				}
+				fmt.Fprintf(&sb, "%x,", tile[sy*tw+sx])
+			}
+		}
+		return sb.String()
+	}
+
+	unique := map[string]bool{}
+	uniqueFlipped := map[string]bool{}
+	r.Tiles = p.NumTiles()
+	for t := 0; t < r.Tiles; t++ {
+		tile := p.Pixels[t*tw*th : (t+1)*tw*th]
+		unique[key(tile, false, false)] = true
+		uniqueFlipped[min(key(tile, false, false), key(tile, true, false),
+			key(tile, false, true), key(tile, true, true))] = true
+	}
+	r.UniqueTiles, r.UniqueFlippedTiles = len(unique), len(uniqueFlipped)
+}
+
+func (r *InfoReport) addSections() error {
+	sections, err := collectSections(r.Product)
+	if err != nil {
+		return err
+	}
+	for _, s := range sections {
+		r.Sections = append(r.Sections, InfoSection{
+			Name:           s.name,
+			Size:           s.rawSize,
+			CompressedSize: len(s.data),
+			Compression:    s.used,
+		})
+	}
+	return nil
+}
+
+// Returns the names of the sections in the mask, e.g. "pixels, palette".
+func (m CreateMask) String() string {
+	names := []string{}
+	for _, section := range []struct {
+		mask CreateMask
+		name string
+	}{{CreateMaskPixels, "pixels"}, {CreateMaskMap, "map"}, {CreateMaskPalette, "palette"}} {
+		if m&section.mask != 0 {
+			names = append(names, section.name)
+		}
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ", ")
+}
+
+// Writes the report as text.
+func (r *InfoReport) Write(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	pf := r.Options
+	p := r.Product
+
+	fmt.Fprintf(tw, "Image:\t%s (%dx%d)\n", r.InputPath, r.Width, r.Height)
+	files := "none"
+	if len(pf.Files) > 0 {
+		files = strings.Join(pf.Files, ", ")
+	}
+	fmt.Fprintf(tw, "Options from:\t%s\n", files)
+
+	fmt.Fprintln(tw, "\nOptions:")
+	fmt.Fprintf(tw, "  bpp\t%d\n", pf.Bpp)
+	if pf.TileWidth > 1 || pf.TileHeight > 1 {
+		fmt.Fprintf(tw, "  tiles\t%dx%d\n", pf.TileWidth, pf.TileHeight)
+	} else {
+		fmt.Fprintf(tw, "  tiles\tnone\n")
+	}
+	fmt.Fprintf(tw, "  export\t%s\n", pf.Create)
+	if len(pf.Palette) > 0 {
+		fixed := []string{}
+		for _, color := range pf.Palette {
+			fixed = append(fixed, hexColor(color))
+		}
+		fmt.Fprintf(tw, "  palette\t%s\n", strings.Join(fixed, " "))
+	}
+	fmt.Fprintf(tw, "  compression\tpixels %s, map %s, palette %s\n",
+		pf.Compression, pf.MapCompression, pf.PaletteCompression)
+	switch {
+	case pf.ChunkSize == ChunkSizeRow:
+		fmt.Fprintf(tw, "  chunk\trow\n")
+	case pf.ChunkSize > 0:
+		fmt.Fprintf(tw, "  chunk\t%d\n", pf.ChunkSize)
+	}
+	fmt.Fprintf(tw, "  name\t%s\n", formatLabel(pf.Name))
+	if len(pf.Segments) > 0 {
+		fmt.Fprintf(tw, "  segments\t%s (bank size %d, align %d)\n",
+			strings.Join(pf.Segments, ", "), pf.BankSize, pf.Align)
+	} else {
+		fmt.Fprintf(tw, "  segment\t%s\n", resolveSegment("", p))
+	}
+	if label, err := pf.Labels.Format(pf.Name, "pixels"); err == nil {
+		fmt.Fprintf(tw, "  pixels label\t%s\n", label)
+	}
+	for _, output := range pf.Outputs {
+		if output.Path != "" {
+			fmt.Fprintf(tw, "  output\t%s: %s\n", output.Type, output.Path)
+		} else {
+			fmt.Fprintf(tw, "  output\t%s\n", output.Type)
+		}
+	}
+
+	fmt.Fprintln(tw, "\nColors:")
+	fmt.Fprintf(tw, "  source\t%d\n", r.SourceColors)
+	fmt.Fprintf(tw, "  converted\t%d\n", r.Colors)
+
+	if r.Err == nil && len(p.Palette) > 0 {
+		fmt.Fprintln(tw, "\nPalette:")
+		used := make([]bool, len(p.Palette))
+		for i := range min(len(pf.Palette), len(used)) {
+			used[i] = true
+		}
+		for _, pixel := range p.Pixels {
+			used[pixel] = true
+		}
+		for i, color := range p.Palette {
+			source := "unused"
+			if used[i] {
+				source = hexColor(p.SourcePalette[i])
+			}
+			fmt.Fprintf(tw, "  %d\t$%04x\t%s\n", i, uint32(color), source)
+		}
+	}
+
+	if r.Tiles > 0 {
+		fmt.Fprintln(tw, "\nTiles:")
+		fmt.Fprintf(tw, "  total\t%d\n", r.Tiles)
+		fmt.Fprintf(tw, "  unique\t%d\n", r.UniqueTiles)
+		fmt.Fprintf(tw, "  unique with flips\t%d\n", r.UniqueFlippedTiles)
+	}
+
+	if len(r.Sections) > 0 {
+		fmt.Fprintln(tw, "\nSizes:\tbytes\tcompressed")
+		total, totalCompressed := 0, 0
+		for _, s := range r.Sections {
+			fmt.Fprintf(tw, "  %s\t%d\t%d (%s)\n", s.Name, s.Size, s.CompressedSize, s.Compression)
+			total += s.Size
+			totalCompressed += s.CompressedSize
+		}
+		fmt.Fprintf(tw, "  total\t%d\t%d\n", total, totalCompressed)
+	}
+
+	if r.Err != nil {
+		fmt.Fprintf(tw, "\nConversion failed: %s\n", r.Err)
+	}
+	return tw.Flush()
+}
+
+// Formats a 24-bit color (0x--BBGGRR) as #rrggbb.
+func hexColor(color Color) string {
+	return fmt.Sprintf("#%02x%02x%02x", color&0xFF, (color>>8)&0xFF, (color>>16)&0xFF)
+}
@@ -0,0 +1,79 @@
+package pmage
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInspect(t *testing.T) {
+	dir := t.TempDir()
+	inputPath := filepath.Join(dir, "font.png")
+	copyTestFile(t, "test/gfx_ifont.png", inputPath)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "font.yaml"), []byte(`
+colors: 4
+transparent: "0072BC"
+export: pixels palette
+compression: lz2
+`), 0644))
+	profile := &Profile{System: SystemSnes}
+
+	report, err := Inspect(profile, ConvertJob{InputPath: inputPath})
+	assert.NoError(t, err)
+	assert.NoError(t, report.Err)
+	assert.Equal(t, 128, report.Width)
+	assert.Equal(t, 2, report.SourceColors)
+	assert.Equal(t, 2, report.Colors)
+	assert.Equal(t, 96, report.Tiles)
+	assert.Equal(t, 96, report.UniqueTiles)
+	assert.Equal(t, 93, report.UniqueFlippedTiles)
+	assert.Len(t, report.Sections, 2)
+	assert.Equal(t, "pixels", report.Sections[0].Name)
+	assert.Equal(t, 1536, report.Sections[0].Size)
+	assert.Less(t, report.Sections[0].CompressedSize, 1536)
+	assert.Equal(t, PixelCompressionLz2, report.Sections[0].Compression)
+	assert.Equal(t, InfoSection{"palette", 8, 8, PixelCompressionNone}, report.Sections[1])
+
+	var out bytes.Buffer
+	assert.NoError(t, report.Write(&out))
+	assert.Contains(t, out.String(), "export        pixels, palette\n")
+	assert.Contains(t, out.String(), "0  $5dc0  #0072bc\n")
+	assert.Contains(t, out.String(), "3  $0000  unused\n")
+	assert.Contains(t, out.String(), "pixels   1536")
+	assert.NotContains(t, out.String(), "Conversion failed")
+
+	// Flipped copies of a tile count as one.
+	report, err = Inspect(profile, ConvertJob{InputPath: "test/flippy16.png",
+		Overrides: parseTestOverrides(t, "tiles=16x16", "bpp=4")})
+	assert.NoError(t, err)
+	assert.Equal(t, 8, report.Tiles)
+	assert.Equal(t, 1, report.UniqueFlippedTiles)
+
+	// Colors and tiles are still counted when there are too many colors.
+	report, err = Inspect(profile, ConvertJob{InputPath: "test/flippy16.png",
+		Overrides: parseTestOverrides(t, "tiles=16x16", "bpp=2", "palette=000000 111111")})
+	assert.NoError(t, err)
+	assert.ErrorIs(t, report.Err, ErrConversion)
+	assert.Equal(t, 3, report.Colors)
+	assert.Equal(t, 8, report.Tiles)
+	assert.Empty(t, report.Sections)
+	out.Reset()
+	assert.NoError(t, report.Write(&out))
+	assert.Contains(t, out.String(), "Conversion failed")
+
+	_, err = Inspect(profile, ConvertJob{InputPath: filepath.Join(dir, "missing.png")})
+	assert.Error(t, err)
+}
+
+func parseTestOverrides(t *testing.T, overrides ...string) []OptionLayer {
+	layers := []OptionLayer{}
+	for _, s := range overrides {
+		layer, err := ParseOptionOverride(s)
+		assert.NoError(t, err)
+		layers = append(layers, layer)
+	}
+	return layers
+}
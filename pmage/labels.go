@@ -0,0 +1,167 @@
+package pmage
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// The case style applied to generated symbols.
+type LabelCase int
+
+const (
+	LabelCaseNone   LabelCase = iota // Keep the template's spelling.
+	LabelCaseSnake                   // gfx_font_pixels
+	LabelCaseCamel                   // gfxFontPixels
+	LabelCasePascal                  // GfxFontPixels
+	LabelCaseUpper                   // GFX_FONT_PIXELS
+)
+
+const DefaultLabelTemplate = "{name}_{section}"
+
+var ErrInvalidLabels = errors.New("invalid label option")
+
+// Options for naming the symbols in the output.
+//
+// A template is a symbol name with placeholders. {name} is the asset name and {section}
+// is what the symbol refers to, e.g. "pixels" or "num_tiles". {Name} and {NAME} (and the
+// same for section) insert the value in PascalCase and UPPER_CASE.
+//
+// The case style is applied to the result of the template, and then the prefix and suffix
+// are added as they are. Symbols derived from a section's label, like its size, are
+// joined in the same case style, e.g. gfx_font_pixels_size or gfxFontPixelsSize.
+type LabelOptions struct {
+	Template string
+	Prefix   string
+	Suffix   string
+	Case     LabelCase
+
+	// Per-section templates, keyed by section name, e.g. "pixels".
+	Sections map[string]string
+}
+
+var labelPlaceholder = regexp.MustCompile(`\{[^}]*\}`)
+var validLabel = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+func ParseLabelCase(name string) (LabelCase, error) {
+	switch strings.ToLower(name) {
+	case "":
+		return LabelCaseNone, nil
+	case "snake":
+		return LabelCaseSnake, nil
+	case "camel":
+		return LabelCaseCamel, nil
+	case "pascal":
+		return LabelCasePascal, nil
+	case "upper":
+		return LabelCaseUpper, nil
+	}
+	return LabelCaseNone, fmt.Errorf("%w: unknown case style \"%s\"", ErrInvalidLabels, name)
+}
+
+// Checks that the templates only use known placeholders.
+func (o *LabelOptions) Validate() error {
+	templates := []string{o.Template}
+	for _, t := range o.Sections {
+		templates = append(templates, t)
+	}
+	for _, t := range templates {
+		for _, p := range labelPlaceholder.FindAllString(t, -1) {
+			switch p {
+			case "{name}", "{Name}", "{NAME}", "{section}", "{Section}", "{SECTION}":
+			default:
+				return fmt.Errorf("%w: unknown placeholder %s in \"%s\"", ErrInvalidLabels, p, t)
+			}
+		}
+	}
+	return nil
+}
+
+// Returns the symbol for a section of the named asset.
+func (o *LabelOptions) Format(name string, section string) (string, error) {
+	template := o.Sections[section]
+	if template == "" {
+		template = o.Template
+	}
+	if template == "" {
+		template = DefaultLabelTemplate
+	}
+
+	name = formatLabel(name)
+	label := strings.NewReplacer(
+		"{name}", name,
+		"{Name}", applyLabelCase(name, LabelCasePascal),
+		"{NAME}", applyLabelCase(name, LabelCaseUpper),
+		"{section}", section,
+		"{Section}", applyLabelCase(section, LabelCasePascal),
+		"{SECTION}", applyLabelCase(section, LabelCaseUpper),
+	).Replace(template)
+
+	label = o.Prefix + applyLabelCase(label, o.Case) + o.Suffix
+	if !validLabel.MatchString(label) {
+		return "", fmt.Errorf("%w: \"%s\" is not a valid symbol", ErrInvalidLabels, label)
+	}
+	return label, nil
+}
+
+// Returns a symbol derived from a label, e.g. its size.
+func (o *LabelOptions) Join(label string, suffix string) string {
+	switch o.Case {
+	case LabelCaseCamel, LabelCasePascal:
+		return label + applyLabelCase(suffix, LabelCasePascal)
+	case LabelCaseUpper:
+		return label + "_" + strings.ToUpper(suffix)
+	}
+	return label + "_" + suffix
+}
+
+// Splits an identifier into words at underscores and lower-to-upper case changes.
+func splitLabelWords(label string) []string {
+	words := []string{}
+	current := []rune{}
+	prevLower := false
+	for _, r := range label {
+		if r == '_' || (unicode.IsUpper(r) && prevLower) {
+			if len(current) > 0 {
+				words = append(words, string(current))
+			}
+			current = current[:0]
+		}
+		if r != '_' {
+			current = append(current, r)
+		}
+		prevLower = unicode.IsLower(r) || unicode.IsDigit(r)
+	}
+	if len(current) > 0 {
+		words = append(words, string(current))
+	}
+	return words
+}
+
+func applyLabelCase(label string, style LabelCase) string {
+	if style == LabelCaseNone {
+		return label
+	}
+
+	words := splitLabelWords(label)
+	for i, word := range words {
+		switch style {
+		case LabelCaseSnake:
+			words[i] = strings.ToLower(word)
+		case LabelCaseUpper:
+			words[i] = strings.ToUpper(word)
+		case LabelCaseCamel, LabelCasePascal:
+			words[i] = strings.ToLower(word)
+			if i > 0 || style == LabelCasePascal {
+				words[i] = strings.ToUpper(word[:1]) + words[i][1:]
+			}
+		}
+	}
+
+	if style == LabelCaseCamel || style == LabelCasePascal {
+		return strings.Join(words, "")
+	}
+	return strings.Join(words, "_")
+}
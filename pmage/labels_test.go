@@ -0,0 +1,107 @@
+package pmage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLabelFormat(t *testing.T) {
+	format := func(options LabelOptions, section string) string {
+		label, err := options.Format("gfx/hud-font.png", section)
+		assert.NoError(t, err)
+		return label
+	}
+
+	assert.Equal(t, "hud_font_pixels", format(LabelOptions{}, "pixels"))
+	assert.Equal(t, "hudFontPixels", format(LabelOptions{Case: LabelCaseCamel}, "pixels"))
+	assert.Equal(t, "HudFontNumTiles", format(LabelOptions{Case: LabelCasePascal}, "num_tiles"))
+	assert.Equal(t, "HUD_FONT_PALETTE", format(LabelOptions{Case: LabelCaseUpper}, "palette"))
+	assert.Equal(t, "gfxHudFontTiles", format(LabelOptions{Template: "gfx{Name}Tiles"}, "pixels"))
+	assert.Equal(t, "g_hud_font_map_", format(LabelOptions{Prefix: "g_", Suffix: "_"}, "map"))
+	assert.Equal(t, "hud_font_pixels", format(LabelOptions{Case: LabelCaseSnake}, "pixels"))
+
+	options := LabelOptions{
+		Template: "{NAME}_{SECTION}",
+		Sections: map[string]string{"pixels": "{name}Tiles"},
+		Case:     LabelCaseCamel,
+	}
+	assert.Equal(t, "hudFontTiles", format(options, "pixels"))
+	assert.Equal(t, "hudFontPalette", format(options, "palette"))
+	assert.Equal(t, "hudFontTilesSize", options.Join("hudFontTiles", "size"))
+
+	_, err := (&LabelOptions{Template: "{name}-{section}"}).Format("font", "pixels")
+	assert.ErrorIs(t, err, ErrInvalidLabels)
+	assert.ErrorIs(t, (&LabelOptions{Template: "{file}"}).Validate(), ErrInvalidLabels)
+}
+
+func TestLoadingLabels(t *testing.T) {
+	profile := &Profile{System: SystemSnes, Labels: LabelOptions{Prefix: "g_", Case: LabelCaseSnake}}
+
+	{
+		pf, err := CreatePmageFileFromYamlString(profile, `labels: "{name}{Section}"`, "test.yaml")
+		assert.NoError(t, err)
+		assert.Equal(t, "{name}{Section}", pf.Labels.Template)
+		assert.Equal(t, "g_", pf.Labels.Prefix)
+	}
+
+	{
+		var pmageFile = `
+labels:
+  case: camel
+  pixels: "{name}Tiles"
+`
+		pf, err := CreatePmageFileFromYamlString(profile, pmageFile, "test.yaml")
+		assert.NoError(t, err)
+		assert.Equal(t, LabelCaseCamel, pf.Labels.Case)
+		assert.Equal(t, "{name}Tiles", pf.Labels.Sections["pixels"])
+		assert.Empty(t, profile.Labels.Sections)
+	}
+
+	{
+		_, err := CreatePmageFileFromYamlString(profile, "labels: {case: kebab}", "test.yaml")
+		assert.ErrorIs(t, err, ErrInvalidLabels)
+	}
+}
+
+func TestCa65Labels(t *testing.T) {
+	p := loadTestFontProduct(t, `
+colors: 16
+labels: {template: "{name}{Section}", case: camel, pixels: "gfx{Name}Tiles"}
+`)
+
+	path := filepath.Join(t.TempDir(), "font.asm")
+	exporter := Ca65Exporter{}
+	assert.NoError(t, exporter.Export(p, path))
+
+	contents, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Contains(t, string(contents), "\t.global gfxGfxIfontTiles\ngfxGfxIfontTiles:\n")
+	assert.Contains(t, string(contents), "\t.global gfxIfontPalette\ngfxIfontPalette:\n")
+
+	contents, err = os.ReadFile(changeExt(path, ".inc"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(contents), "gfxIfontNumTiles = 96\n")
+	assert.Contains(t, string(contents), "gfxGfxIfontTilesSize = 3072\n")
+	assert.Contains(t, string(contents), "gfxIfontPaletteRawSize = 32\n")
+
+	// Sections with the same symbol.
+	p.Pmf.Labels = LabelOptions{Template: "{name}"}
+	assert.ErrorIs(t, exporter.Export(p, path), ErrInvalidLabels)
+
+	// A label that's the same as a symbol derived from another section.
+	p.Pmf.Labels = LabelOptions{Sections: map[string]string{"palette": "{name}_pixels_size"}}
+	err = exporter.Export(p, path)
+	assert.ErrorIs(t, err, ErrInvalidLabels)
+	assert.ErrorContains(t, err, "pixels size and palette are both named gfx_ifont_pixels_size")
+	p.Pmf.Labels = LabelOptions{Sections: map[string]string{"pixels": "{name}_palette_raw_size"}}
+	assert.ErrorIs(t, exporter.Export(p, path), ErrInvalidLabels)
+	p.Pmf.Labels = LabelOptions{Sections: map[string]string{"palette": "{name}_pixels_2"}}
+	err = exporter.Export(p, path)
+	assert.ErrorIs(t, err, ErrInvalidLabels)
+	assert.ErrorContains(t, err, "palette and pixels part 2 are both named gfx_ifont_pixels_2")
+	p.Pmf.Labels = LabelOptions{Sections: map[string]string{"palette": "{name}_pixels_2b"}}
+	assert.NoError(t, exporter.Export(p, path))
+}
@@ -4,8 +4,13 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"os"
+	"path/filepath"
+	"reflect"
 	"regexp"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -23,43 +28,309 @@ const (
 	CreateMaskAll     CreateMask = 0xFFFFFFFF
 )
 
+const ChunkSizeRow = -1
+
 const (
+	// Try every compressor and keep the smallest result.
+	PixelCompressionAuto PixelCompression = -1
+
 	PixelCompressionNone PixelCompression = 0
 	PixelCompressionLz77 PixelCompression = 1
+	PixelCompressionLz2  PixelCompression = 2
 )
 
 // A pmage file contains conversion options for a single image. The base filename of the
 // image matches the base filename of the pmage file.
 type PmageFile struct {
-	Profile     *Profile
-	TileWidth   int16
-	TileHeight  int16
-	Create      CreateMask
-	Bpp         int16
-	Palette     []Color
-	Compression PixelCompression
-	Name        string
-	Segment     string
+	Profile            *Profile
+	TileWidth          int16
+	TileHeight         int16
+	Create             CreateMask
+	Bpp                int16
+	Palette            []Color
+	Compression        PixelCompression // For the pixel data.
+	MapCompression     PixelCompression
+	PaletteCompression PixelCompression
+	Name               string
+	Segment            string
+	Labels             LabelOptions
+
+	// Bank splitting. When Segments is set, data is spread across those segments,
+	// switching whenever BankSize bytes are used. Pieces are aligned to Align bytes.
+	Segments []string
+	BankSize int
+	Align    int
+
+	// If set, the pixel data is split into chunks of this many bytes that are compressed
+	// separately. ChunkSizeRow makes each chunk one row of tiles.
+	ChunkSize int
+
+	// Exports to write in addition to the ones requested at the command line.
+	Outputs []Output
+
+	// The files the options were loaded from.
+	Files []string
+
+	// Files that were looked for but don't exist, like a missing pmage file. Creating one
+	// would change the options.
+	Missing []string
+}
+
+// An export to write. If Path is empty, it's derived from the output path given to the
+// converter.
+type Output struct {
+	Type string
+	Path string
 }
 
 type pmageFileInput struct {
 	// Used for the symbols in the output. Not used if name is specified.
-	Filename string
+	Filename string `yaml:"-"`
+
+	// Where each option was set, for error messages.
+	positions map[string]optionPosition
+
+	Tiles       string           `yaml:"tiles"`
+	Export      string           `yaml:"export"`
+	Bpp         int              `yaml:"bpp"`
+	Colors      int              `yaml:"colors"` // Alternate way to specify bpp
+	Palette     string           `yaml:"palette"`
+	Transparent string           `yaml:"transparent"` // Alias for palette
+	Compression compressionInput `yaml:"compression"`
+	Name        string           `yaml:"name"`
+	Segment     string           `yaml:"segment"`
+	Segments    string           `yaml:"segments"`
+	BankSize    int              `yaml:"bank_size"`
+	Align       int              `yaml:"align"`
+	Chunk       string           `yaml:"chunk"`
+	Labels      labelsInput      `yaml:"labels"`
+	Outputs     []outputInput    `yaml:"outputs"`
+}
+
+// An output is an export type, or a mapping with the type and path, e.g.
+// `outputs: [ca65, {type: preview, path: previews/font.png}]`.
+type outputInput struct {
+	Type string `yaml:"type"`
+	Path string `yaml:"path"`
+}
+
+func (o *outputInput) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		return value.Decode(&o.Type)
+	}
+	type plain outputInput
+	return value.Decode((*plain)(o))
+}
+
+// Compression can be a single scheme, which applies to the pixel data, or a mapping with
+// a scheme for each section, e.g. `compression: {pixels: lz77, map: lz2, palette: none}`.
+type compressionInput struct {
+	Pixels  string `yaml:"pixels"`
+	Map     string `yaml:"map"`
+	Palette string `yaml:"palette"`
+}
+
+func (c *compressionInput) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		return value.Decode(&c.Pixels)
+	}
+	type plain compressionInput
+	return value.Decode((*plain)(c))
+}
 
-	Tiles       string `yaml:"tiles"`
-	Export      string `yaml:"export"`
-	Bpp         int    `yaml:"bpp"`
-	Colors      int    `yaml:"colors"` // Alternate way to specify bpp
-	Palette     string `yaml:"palette"`
-	Transparent string `yaml:"transparent"` // Alias for palette
-	Compression string `yaml:"compression"`
-	Name        string `yaml:"name"`
-	Segment     string `yaml:"segment"`
+// Labels can be a template, or a mapping with the template and other options, e.g.
+// `labels: {template: "gfx{Name}{Section}", case: camel, pixels: "gfx{Name}Tiles"}`.
+type labelsInput struct {
+	Template string `yaml:"template"`
+	Prefix   string `yaml:"prefix"`
+	Suffix   string `yaml:"suffix"`
+	Case     string `yaml:"case"`
+	Pixels   string `yaml:"pixels"`
+	Map      string `yaml:"map"`
+	Palette  string `yaml:"palette"`
+}
+
+func (l *labelsInput) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		return value.Decode(&l.Template)
+	}
+	type plain labelsInput
+	return value.Decode((*plain)(l))
 }
 
 var ErrInvalidColors = errors.New("bpp is invalid")
 var ErrInvalidExportOption = errors.New("invalid export option")
 var ErrInvalidTileSize = errors.New("invalid tile size specified")
+var ErrInvalidChunkSize = errors.New("invalid chunk size")
+var ErrInvalidBanking = errors.New("invalid bank option")
+var ErrInvalidOutput = errors.New("invalid output")
+var ErrUnknownOption = errors.New("unknown option")
+
+type optionPosition struct {
+	file   string
+	line   int
+	column int
+}
+
+// Adds the position of the first of the options that's set to an error, or the
+// filename if none of them are.
+func (pfinput *pmageFileInput) errorAt(err error, keys ...string) error {
+	for _, key := range keys {
+		if pos, ok := pfinput.positions[key]; ok && pos.line == 0 {
+			return fmt.Errorf("%s: %w", pos.file, err)
+		} else if ok {
+			return fmt.Errorf("%s:%d:%d: %w", pos.file, pos.line, pos.column, err)
+		}
+	}
+	if pfinput.Filename != "" {
+		return fmt.Errorf("%s: %w", pfinput.Filename, err)
+	}
+	return err
+}
+
+// Number of single character edits to turn a into b, for suggesting fixes to typos.
+func editDistance(a string, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+func unknownOptionError(key *yaml.Node, file string, known []string) error {
+	err := fmt.Errorf("%s:%d:%d: %w \"%s\"", file, key.Line, key.Column, ErrUnknownOption, key.Value)
+	if key.Line == 0 {
+		err = fmt.Errorf("%s: %w \"%s\"", file, ErrUnknownOption, key.Value)
+	}
+
+	sort.Strings(known)
+	best, bestDistance := "", 3
+	for _, name := range known {
+		if d := editDistance(key.Value, name); d < bestDistance {
+			best, bestDistance = name, d
+		}
+	}
+	if best != "" {
+		err = fmt.Errorf("%w, did you mean \"%s\"?", err, best)
+	}
+	return err
+}
+
+// Checks for unknown keys in the options, which are usually typos. Decoding doesn't catch
+// them, even with KnownFields, since layers are decoded from nodes and nested options
+// like `compression: {pixel: lz77}` are decoded by their own UnmarshalYAML.
+func checkKnownFields(node *yaml.Node, t reflect.Type, file string) error {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case node.Kind == yaml.SequenceNode && t.Kind() == reflect.Slice:
+		for _, item := range node.Content {
+			if err := checkKnownFields(item, t.Elem(), file); err != nil {
+				return err
+			}
+		}
+
+	case node.Kind == yaml.MappingNode && t.Kind() == reflect.Struct:
+		fields := map[string]reflect.Type{}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+			if !field.IsExported() || name == "-" {
+				continue
+			}
+			if name == "" {
+				name = strings.ToLower(field.Name)
+			}
+			fields[name] = field.Type
+		}
+
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			fieldType, ok := fields[key.Value]
+			if !ok {
+				return unknownOptionError(key, file, slices.Collect(maps.Keys(fields)))
+			}
+			if err := checkKnownFields(value, fieldType, file); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+var yamlLineRegex = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+// Reformats errors from the YAML library to point at the file, e.g. "gfx.yaml:2: mapping
+// key "bpp" already defined at line 1".
+func yamlError(file string, err error) error {
+	messages := []string{err.Error()}
+	if typeError, ok := err.(*yaml.TypeError); ok {
+		messages = typeError.Errors
+	}
+	for i, message := range messages {
+		if m := yamlLineRegex.FindStringSubmatch(message); m != nil {
+			messages[i] = fmt.Sprintf("%s:%s: %s", file, m[1], m[2])
+		} else {
+			messages[i] = fmt.Sprintf("%s: %s", file, message)
+		}
+	}
+	return errors.New(strings.Join(messages, "\n"))
+}
+
+// Decodes options from a pmage file or a layer on top of the ones already in pfinput.
+// Unknown options are errors.
+func (pfinput *pmageFileInput) decode(node *yaml.Node, file string) error {
+	root := node
+	if root.Kind == yaml.DocumentNode && len(root.Content) > 0 {
+		root = root.Content[0]
+	}
+	if root.Kind == 0 || root.Kind == yaml.DocumentNode || (root.Kind == yaml.ScalarNode && root.Tag == "!!null") {
+		// Empty file.
+		return nil
+	}
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("%s:%d:%d: expected a mapping of options", file, root.Line, root.Column)
+	}
+
+	if err := checkKnownFields(root, reflect.TypeOf(*pfinput), file); err != nil {
+		return err
+	}
+	if err := root.Decode(pfinput); err != nil {
+		return yamlError(file, err)
+	}
+
+	if pfinput.positions == nil {
+		pfinput.positions = map[string]optionPosition{}
+	}
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		value := root.Content[i+1]
+		pfinput.positions[root.Content[i].Value] = optionPosition{file, value.Line, value.Column}
+	}
+	return nil
+}
+
+// Parses and decodes a YAML document of options.
+func (pfinput *pmageFileInput) decodeYaml(reader io.Reader, file string) error {
+	var doc yaml.Node
+	if err := yaml.NewDecoder(reader).Decode(&doc); err != nil && err != io.EOF {
+		return yamlError(file, err)
+	}
+	return pfinput.decode(&doc, file)
+}
 
 // Convenience function for loading from a YAML string.
 func CreatePmageFileFromYamlString(profile *Profile, data string, filename string) (*PmageFile, error) {
@@ -71,12 +342,252 @@ func CreatePmageFileFromYamlString(profile *Profile, data string, filename strin
 	return &pf, nil
 }
 
+// Pmage file options from somewhere other than the image's own pmage file, like a
+// project file or the command line. Layers are applied in order.
+type OptionLayer struct {
+	// The file the options come from. Empty if they're not from a file.
+	Source string
+
+	// Describes the options in error messages if they're not from a file, e.g.
+	// "--set bpp=2".
+	Name string
+
+	// If nil, the options are read from Source when they're loaded.
+	Node *yaml.Node
+}
+
+var ErrInvalidOverride = errors.New("invalid option override")
+
+// Parses an option given as "key=value", like `bpp=2`. The value is YAML, e.g.
+// `outputs=[ca65, json]`. Nested options are set with dots, e.g. `compression.map=lz2`.
+func ParseOptionOverride(s string) (OptionLayer, error) {
+	key, value, ok := strings.Cut(s, "=")
+	path := strings.Split(strings.TrimSpace(key), ".")
+	if !ok || slices.Contains(path, "") {
+		return OptionLayer{}, fmt.Errorf("%w: expected key=value, got \"%s\"", ErrInvalidOverride, s)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(value), &doc); err != nil {
+		return OptionLayer{}, fmt.Errorf("%w: %s: %w", ErrInvalidOverride, s, err)
+	}
+	node := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null"}
+	if len(doc.Content) > 0 {
+		node = doc.Content[0]
+	}
+	clearPositions(node)
+
+	for i := len(path) - 1; i >= 0; i-- {
+		keyNode := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: path[i]}
+		node = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Content: []*yaml.Node{keyNode, node}}
+	}
+	return OptionLayer{Name: "--set " + s, Node: node}, nil
+}
+
+// The options don't come from a file, so lines and columns would be misleading.
+func clearPositions(node *yaml.Node) {
+	node.Line, node.Column = 0, 0
+	for _, child := range node.Content {
+		clearPositions(child)
+	}
+}
+
+// Decodes a layer on top of the options in pfinput, and adds its file to pf.Files.
+func (pfinput *pmageFileInput) decodeLayer(pf *PmageFile, layer OptionLayer) error {
+	if layer.Source != "" && !slices.Contains(pf.Files, layer.Source) {
+		pf.Files = append(pf.Files, layer.Source)
+	}
+
+	if layer.Node == nil {
+		file, err := os.Open(layer.Source)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		return pfinput.decodeYaml(file, layer.Source)
+	}
+
+	name := layer.Source
+	if name == "" {
+		name = layer.Name
+	}
+	return pfinput.decode(layer.Node, name)
+}
+
+// Names of the files with defaults for the pmage files in their directory and below.
+var DefaultsFileNames = []string{"_defaults.yaml", "pmage.defaults.yaml"}
+
+// Finds the defaults files for a pmage file, from the outermost directory in. Also
+// returns the paths that were checked but don't exist.
+//
+// The search goes up from the pmage file's directory and stops at a directory with a
+// project file or at a defaults file with `root: true`, so defaults files above the
+// project, e.g. in the home directory, don't apply. The working directory doesn't matter.
+func findDefaultsFiles(path string) ([]string, []string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	found, missing := []string{}, []string{}
+	for dir := filepath.Dir(absPath); ; dir = filepath.Dir(dir) {
+		inDir := ""
+		for _, name := range DefaultsFileNames {
+			candidate := filepath.Join(dir, name)
+			// Keep the paths relative if the pmage file's is, since they end up in
+			// dependency files.
+			if !filepath.IsAbs(path) {
+				if rel, err := filepath.Rel(cwd, candidate); err == nil {
+					candidate = rel
+				}
+			}
+
+			info, err := os.Stat(candidate)
+			if errors.Is(err, os.ErrNotExist) {
+				missing = append(missing, candidate)
+				continue
+			} else if err != nil {
+				return nil, nil, err
+			}
+			if info.IsDir() {
+				continue
+			}
+			if inDir != "" {
+				return nil, nil, fmt.Errorf("%s and %s are both defaults for %s", inDir, candidate, path)
+			}
+			inDir = candidate
+		}
+		if inDir != "" {
+			found = append(found, inDir)
+			root, err := isRootDefaultsFile(inDir)
+			if err != nil {
+				return nil, nil, err
+			}
+			if root {
+				break
+			}
+		}
+		if info, err := os.Stat(filepath.Join(dir, DefaultProjectFile)); err == nil && !info.IsDir() {
+			break
+		}
+		if filepath.Dir(dir) == dir {
+			break
+		}
+	}
+
+	slices.Reverse(found)
+	return found, missing, nil
+}
+
+// Defaults files can set `root: true` to stop the search for defaults files above them.
+func isRootDefaultsFile(path string) (bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	var marker struct {
+		Root bool `yaml:"root"`
+	}
+	if err := yaml.Unmarshal(data, &marker); err != nil {
+		return false, yamlError(path, err)
+	}
+	return marker.Root, nil
+}
+
+// Removes the `root` marker from a defaults file, since it isn't an option.
+func removeRootKey(doc *yaml.Node) {
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return
+	}
+	mapping := doc.Content[0]
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == "root" {
+			mapping.Content = slices.Delete(mapping.Content, i, i+2)
+			return
+		}
+	}
+}
+
+// Reads the defaults files for a pmage file as layers, from the outermost directory in.
+func loadDefaultsLayers(path string) ([]OptionLayer, []string, error) {
+	files, missing, err := findDefaultsFiles(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	layers := []OptionLayer{}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, nil, err
+		}
+		var doc yaml.Node
+		if err = yaml.Unmarshal(data, &doc); err != nil {
+			return nil, nil, yamlError(file, err)
+		}
+		if len(doc.Content) == 0 {
+			// Empty file.
+			continue
+		}
+		removeRootKey(&doc)
+		layers = append(layers, OptionLayer{Source: file, Node: &doc})
+	}
+	return layers, missing, nil
+}
+
+// Loads the pmage file at path on top of the layers and the defaults files in its
+// directory and the ones above it. The closest defaults file has priority. The overrides
+// are applied last, on top of the pmage file. If there are any layers, defaults or
+// overrides, the pmage file is optional.
+func (pf *PmageFile) LoadYamlFileWithLayers(profile *Profile, layers []OptionLayer, path string, overrides []OptionLayer) error {
+	defaults, missing, err := loadDefaultsLayers(path)
+	if err != nil {
+		return err
+	}
+	pf.Missing = append(pf.Missing, missing...)
+	layers = append(slices.Clip(layers), defaults...)
+
+	pfinput := pmageFileInput{}
+	for _, layer := range layers {
+		if err := pfinput.decodeLayer(pf, layer); err != nil {
+			return err
+		}
+	}
+
+	file, err := os.Open(path)
+	if err == nil {
+		defer file.Close()
+		pf.Files = append(pf.Files, path)
+		if err = pfinput.decodeYaml(file, path); err != nil {
+			return err
+		}
+	} else if len(layers)+len(overrides) == 0 || !errors.Is(err, os.ErrNotExist) {
+		return err
+	} else {
+		pf.Missing = append(pf.Missing, path)
+	}
+
+	for _, layer := range overrides {
+		if err := pfinput.decodeLayer(pf, layer); err != nil {
+			return err
+		}
+	}
+
+	pfinput.Filename = path
+	return pf.Load(profile, pfinput)
+}
+
 func (pf *PmageFile) LoadYamlFile(profile *Profile, path string) error {
 	file, err := os.Open(path)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
+	pf.Files = append(pf.Files, path)
 	return pf.LoadYaml(profile, file, path)
 }
 
@@ -87,7 +598,9 @@ func (pf *PmageFile) LoadYamlString(profile *Profile, data string, filename stri
 func (pf *PmageFile) LoadYaml(profile *Profile, reader io.Reader, filename string) error {
 
 	pfinput := pmageFileInput{}
-	yaml.NewDecoder(reader).Decode(&pfinput)
+	if err := pfinput.decodeYaml(reader, filename); err != nil {
+		return err
+	}
 	pfinput.Filename = filename
 	return pf.Load(profile, pfinput)
 }
@@ -98,27 +611,47 @@ func (pf *PmageFile) Load(profile *Profile, pfinput pmageFileInput) error {
 	pf.Profile = profile
 
 	if err := pf.parseBpp(pfinput); err != nil {
-		return err
+		return pfinput.errorAt(err, "bpp", "colors")
 	}
 
 	if err := pf.parseTileSize(pfinput); err != nil {
-		return err
+		return pfinput.errorAt(err, "tiles")
 	}
 
 	if err := pf.parseExportMask(pfinput); err != nil {
-		return err
+		return pfinput.errorAt(err, "export")
 	}
 
 	if err := pf.parsePalette(pfinput); err != nil {
-		return err
+		return pfinput.errorAt(err, "palette", "transparent")
 	}
 
 	if err := pf.parseCompression(pfinput); err != nil {
-		return err
+		return pfinput.errorAt(err, "compression")
 	}
 
 	if err := pf.parseName(pfinput); err != nil {
-		return err
+		return pfinput.errorAt(err, "name")
+	}
+
+	if err := pf.parseSegment(pfinput); err != nil {
+		return pfinput.errorAt(err, "segment")
+	}
+
+	if err := pf.parseBanking(pfinput); err != nil {
+		return pfinput.errorAt(err, "bank_size", "align", "segments")
+	}
+
+	if err := pf.parseLabels(pfinput); err != nil {
+		return pfinput.errorAt(err, "labels")
+	}
+
+	if err := pf.parseOutputs(pfinput); err != nil {
+		return pfinput.errorAt(err, "outputs")
+	}
+
+	if err := pf.parseChunk(pfinput); err != nil {
+		return pfinput.errorAt(err, "chunk")
 	}
 
 	return nil
@@ -163,25 +696,31 @@ func (pf *PmageFile) parseTileSize(input pmageFileInput) error {
 		tiles = "8x8"
 	}
 
+	w, h, err := ParseTileSize(tiles)
+	if err != nil {
+		return err
+	}
+	pf.TileWidth, pf.TileHeight = int16(w), int16(h)
+	return nil
+}
+
+// Parses a tile size like "8x8", or "8" for square tiles.
+func ParseTileSize(tiles string) (int, int, error) {
 	if tileFormatX.MatchString(tiles) {
 		m := tileFormatX.FindStringSubmatch(tiles)
 		w, _ := strconv.Atoi(m[1])
 		w = max(w, 1)
-		pf.TileWidth, pf.TileHeight = int16(w), int16(w)
-		return nil
+		return w, w, nil
 	}
 
 	if tileFormatXbyX.MatchString(tiles) {
 		m := tileFormatXbyX.FindStringSubmatch(tiles)
 		w, _ := strconv.Atoi(m[1])
 		h, _ := strconv.Atoi(m[2])
-		w = max(w, 1)
-		h = max(h, 1)
-		pf.TileWidth, pf.TileHeight = int16(w), int16(h)
-		return nil
+		return max(w, 1), max(h, 1), nil
 	}
 
-	return ErrInvalidTileSize
+	return 0, 0, ErrInvalidTileSize
 }
 
 // The export mask controls what data is exported into the final result. The `export`
@@ -211,7 +750,7 @@ func (pf *PmageFile) parseExportMask(input pmageFileInput) error {
 		case "palette":
 			mask |= CreateMaskPalette
 		default:
-			return fmt.Errorf("%w: %s", ErrInvalidExportOption, part)
+			return fmt.Errorf("%w \"%s\"", ErrInvalidExportOption, part)
 		}
 	}
 
@@ -273,19 +812,54 @@ func (pf *PmageFile) parsePalette(pfinput pmageFileInput) error {
 	return nil
 }
 
-// The compression field controls the compression encoding used for the pixel data.
+// The compression field controls the compression encoding used for each section. A
+// scheme can name a registered compressor, or be "auto" to pick the smallest result.
 func (pf *PmageFile) parseCompression(pfinput pmageFileInput) error {
-	enc := strings.TrimSpace(pfinput.Compression)
-	enc = strings.ToLower(enc)
-	switch enc {
-	case "lz77":
-		pf.Compression = PixelCompressionLz77
+	var err error
+	if pf.Compression, err = pf.parseCompressionScheme(pfinput.Compression.Pixels); err != nil {
+		return err
+	}
+	if pf.MapCompression, err = pf.parseCompressionScheme(pfinput.Compression.Map); err != nil {
+		return err
+	}
+	if pf.PaletteCompression, err = pf.parseCompressionScheme(pfinput.Compression.Palette); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (pf *PmageFile) parseCompressionScheme(scheme string) (PixelCompression, error) {
+	return ParsePixelCompression(scheme)
+}
+
+// The chunk field splits the pixel data for streaming. It's either a size in bytes, with
+// an optional K or KB suffix for kilobytes (e.g. "2KB" is 2048), or "row" for one row of
+// tiles per chunk.
+func (pf *PmageFile) parseChunk(pfinput pmageFileInput) error {
+	chunk := strings.ToLower(strings.TrimSpace(pfinput.Chunk))
+	switch chunk {
 	case "", "none":
-		pf.Compression = PixelCompressionNone
-	default:
-		return fmt.Errorf("invalid compression: %s", enc)
+		pf.ChunkSize = 0
+		return nil
+	case "row":
+		pf.ChunkSize = ChunkSizeRow
+		return nil
 	}
 
+	multiplier := 1
+	for _, suffix := range []string{"kb", "k"} {
+		if trimmed, ok := strings.CutSuffix(chunk, suffix); ok {
+			chunk, multiplier = strings.TrimSpace(trimmed), 1024
+			break
+		}
+	}
+
+	size, err := strconv.Atoi(chunk)
+	size *= multiplier
+	if err != nil || size <= 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidChunkSize, pfinput.Chunk)
+	}
+	pf.ChunkSize = size
 	return nil
 }
 
@@ -301,3 +875,77 @@ func (pf *PmageFile) parseSegment(pfinput pmageFileInput) error {
 	pf.Segment = pfinput.Segment
 	return nil
 }
+
+// The `labels` field overrides the profile's label options. Only the options that are set
+// are replaced.
+func (pf *PmageFile) parseLabels(pfinput pmageFileInput) error {
+	input := pfinput.Labels
+	pf.Labels = pf.Profile.Labels
+	pf.Labels.Sections = map[string]string{}
+	for section, template := range pf.Profile.Labels.Sections {
+		pf.Labels.Sections[section] = template
+	}
+
+	if input.Template != "" {
+		pf.Labels.Template = input.Template
+	}
+	if input.Prefix != "" {
+		pf.Labels.Prefix = input.Prefix
+	}
+	if input.Suffix != "" {
+		pf.Labels.Suffix = input.Suffix
+	}
+	if input.Case != "" {
+		labelCase, err := ParseLabelCase(input.Case)
+		if err != nil {
+			return err
+		}
+		pf.Labels.Case = labelCase
+	}
+	for section, template := range map[string]string{
+		"pixels": input.Pixels, "map": input.Map, "palette": input.Palette,
+	} {
+		if template != "" {
+			pf.Labels.Sections[section] = template
+		}
+	}
+
+	return pf.Labels.Validate()
+}
+
+// Output paths are relative to the pmage file.
+func (pf *PmageFile) parseOutputs(pfinput pmageFileInput) error {
+	pf.Outputs = nil
+	for _, input := range pfinput.Outputs {
+		output := Output{Type: strings.ToLower(strings.TrimSpace(input.Type)), Path: input.Path}
+		if !isExportType(output.Type) {
+			return fmt.Errorf("%w: unknown export type \"%s\"", ErrInvalidOutput, input.Type)
+		}
+		if output.Path != "" && !filepath.IsAbs(output.Path) {
+			output.Path = filepath.Join(filepath.Dir(pfinput.Filename), output.Path)
+		}
+		pf.Outputs = append(pf.Outputs, output)
+	}
+	return nil
+}
+
+// The `segments` field is a space-separated list of segments for large data to be split
+// across, one per bank. `bank_size` defaults to the profile's bank size.
+func (pf *PmageFile) parseBanking(pfinput pmageFileInput) error {
+	pf.Segments = strings.Fields(pfinput.Segments)
+
+	pf.BankSize = pfinput.BankSize
+	if pf.BankSize == 0 {
+		pf.BankSize = pf.Profile.DefaultBankSize()
+	}
+	if pf.BankSize < 0 {
+		return fmt.Errorf("%w: bank_size %d", ErrInvalidBanking, pf.BankSize)
+	}
+
+	pf.Align = max(pfinput.Align, 1)
+	if pf.Align&(pf.Align-1) != 0 || pf.Align > pf.BankSize {
+		return fmt.Errorf("%w: align %d", ErrInvalidBanking, pfinput.Align)
+	}
+
+	return nil
+}
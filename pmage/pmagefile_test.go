@@ -1,6 +1,8 @@
 package pmage
 
 import (
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -37,3 +39,216 @@ bpp: 3
 	}
 
 }
+
+func TestLoadingCompression(t *testing.T) {
+	profile := &Profile{System: SystemSnes}
+
+	{
+		// A single scheme applies to the pixels only.
+		pf, err := CreatePmageFileFromYamlString(profile, "compression: lz77", "test.yaml")
+		assert.NoError(t, err)
+		assert.Equal(t, PixelCompressionLz77, pf.Compression)
+		assert.Equal(t, PixelCompressionNone, pf.MapCompression)
+		assert.Equal(t, PixelCompressionNone, pf.PaletteCompression)
+	}
+
+	{
+		// Per-section schemes.
+		var pmageFile = `
+compression:
+  pixels: lz77
+  map: lz2
+  palette: auto
+`
+		pf, err := CreatePmageFileFromYamlString(profile, pmageFile, "test.yaml")
+		assert.NoError(t, err)
+		assert.Equal(t, PixelCompressionLz77, pf.Compression)
+		assert.Equal(t, PixelCompressionLz2, pf.MapCompression)
+		assert.Equal(t, PixelCompressionAuto, pf.PaletteCompression)
+	}
+
+	{
+		_, err := CreatePmageFileFromYamlString(profile, "compression: {map: lzma}", "test.yaml")
+		assert.Error(t, err)
+	}
+}
+
+func TestLoadingOutputs(t *testing.T) {
+	profile := &Profile{System: SystemSnes}
+
+	var pmageFile = `
+outputs:
+  - json
+  - type: preview
+    path: previews/font.png
+`
+	pf, err := CreatePmageFileFromYamlString(profile, pmageFile, "gfx/font.yaml")
+	assert.NoError(t, err)
+	assert.Equal(t, []Output{
+		{Type: "json"},
+		{Type: "preview", Path: filepath.Join("gfx", "previews", "font.png")},
+	}, pf.Outputs)
+
+	_, err = CreatePmageFileFromYamlString(profile, "outputs: [gif]", "font.yaml")
+	assert.ErrorIs(t, err, ErrInvalidOutput)
+}
+
+func TestDefaultsFiles(t *testing.T) {
+	profile := &Profile{System: SystemSnes}
+	dir := t.TempDir()
+	write := func(path string, content string) {
+		path = filepath.Join(dir, path)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	write("_defaults.yaml", "bpp: 8\ntiles: 16x16")
+	write("game/_defaults.yaml", "root: true\nbpp: 2\nsegment: GFX\ncompression: lz77")
+	write("game/sprites/pmage.defaults.yaml", "bpp: 4\nname: sprite")
+	write("game/sprites/hero.yaml", "name: hero")
+	sprites := filepath.Join(dir, "game", "sprites")
+
+	// Closer defaults override ones further up, and the pmage file overrides them all.
+	// The search stops at the root defaults file.
+	var pf PmageFile
+	assert.NoError(t, pf.LoadYamlFileWithLayers(profile, nil, filepath.Join(sprites, "hero.yaml"), nil))
+	assert.EqualValues(t, 4, pf.Bpp)
+	assert.Equal(t, "GFX", pf.Segment)
+	assert.Equal(t, PixelCompressionLz77, pf.Compression)
+	assert.Equal(t, "hero", pf.Name)
+	assert.EqualValues(t, 8, pf.TileWidth)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "game", "_defaults.yaml"),
+		filepath.Join(sprites, "pmage.defaults.yaml"),
+		filepath.Join(sprites, "hero.yaml"),
+	}, pf.Files)
+	assert.Contains(t, pf.Missing, filepath.Join(sprites, "_defaults.yaml"))
+	assert.NotContains(t, pf.Missing, filepath.Join(dir, "pmage.defaults.yaml"))
+
+	// The pmage file is optional when there are defaults.
+	pf = PmageFile{}
+	assert.NoError(t, pf.LoadYamlFileWithLayers(profile, nil, filepath.Join(sprites, "enemy.yaml"), nil))
+	assert.Equal(t, "sprite", pf.Name)
+	assert.Contains(t, pf.Missing, filepath.Join(sprites, "enemy.yaml"))
+
+	// A project file also stops the search.
+	write("project/pmage.yaml", "assets: []")
+	write("project/_defaults.yaml", "bpp: 4")
+	found, _, err := findDefaultsFiles(filepath.Join(dir, "project", "gfx", "font.yaml"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "project", "_defaults.yaml")}, found)
+
+	// Only one defaults file per directory.
+	write("game/sprites/_defaults.yaml", "bpp: 8")
+	pf = PmageFile{}
+	assert.Error(t, pf.LoadYamlFileWithLayers(profile, nil, filepath.Join(sprites, "hero.yaml"), nil))
+}
+
+func TestDefaultsFilesIgnoreWorkingDirectory(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "_defaults.yaml"), []byte("root: true\nbpp: 4"), 0644))
+	sprites := filepath.Join(dir, "gfx", "sprites")
+	assert.NoError(t, os.MkdirAll(sprites, 0755))
+
+	cwd, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(sprites))
+	defer os.Chdir(cwd)
+
+	// Defaults above the working directory still apply.
+	found, missing, err := findDefaultsFiles("hero.yaml")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join("..", "..", "_defaults.yaml")}, found)
+	assert.Equal(t, []string{
+		"_defaults.yaml",
+		"pmage.defaults.yaml",
+		filepath.Join("..", "_defaults.yaml"),
+		filepath.Join("..", "pmage.defaults.yaml"),
+		filepath.Join("..", "..", "pmage.defaults.yaml"),
+	}, missing)
+}
+
+func TestStrictLoading(t *testing.T) {
+	profile := &Profile{System: SystemSnes}
+	load := func(data string) error {
+		_, err := CreatePmageFileFromYamlString(profile, data, "gfx.yaml")
+		return err
+	}
+
+	// Unknown options, including nested ones.
+	err := load("tiles: 8x8\ntile: 8x8")
+	assert.ErrorIs(t, err, ErrUnknownOption)
+	assert.EqualError(t, err, `gfx.yaml:2:1: unknown option "tile", did you mean "tiles"?`)
+	err = load("compression: {pixel: lz77}")
+	assert.EqualError(t, err, `gfx.yaml:1:15: unknown option "pixel", did you mean "pixels"?`)
+	err = load("outputs: [ca65, {type: json, destination: x.json}]")
+	assert.EqualError(t, err, `gfx.yaml:1:30: unknown option "destination"`)
+	assert.ErrorIs(t, load("filename: x"), ErrUnknownOption)
+
+	// Decoding errors.
+	assert.EqualError(t, load("bpp: 2\nbpp: 4"), `gfx.yaml:2: mapping key "bpp" already defined at line 1`)
+	assert.EqualError(t, load("bpp: two"), "gfx.yaml:1: cannot unmarshal !!str `two` into int")
+	assert.EqualError(t, load("- bpp: 2"), "gfx.yaml:1:1: expected a mapping of options")
+
+	// Validation errors point at the option.
+	err = load("tiles: 8x8\nexport: pixels pallete")
+	assert.ErrorIs(t, err, ErrInvalidExportOption)
+	assert.EqualError(t, err, `gfx.yaml:2:9: invalid export option "pallete"`)
+	err = load("# colors\n\n   colors: 3")
+	assert.ErrorIs(t, err, ErrInvalidColors)
+	assert.EqualError(t, err, "gfx.yaml:3:12: bpp is invalid: 3")
+
+	// Empty files are fine.
+	assert.NoError(t, load(""))
+	assert.NoError(t, load("# nothing here"))
+}
+
+func TestOptionOverrides(t *testing.T) {
+	profile := &Profile{System: SystemSnes}
+	dir := t.TempDir()
+	yamlPath := filepath.Join(dir, "font.yaml")
+	assert.NoError(t, os.WriteFile(yamlPath, []byte("bpp: 4\ntiles: 16x16\nsegment: GFX"), 0644))
+	configPath := filepath.Join(dir, "config.yaml")
+	assert.NoError(t, os.WriteFile(configPath, []byte("segment: CONFIG\nname: font"), 0644))
+
+	overrides := []OptionLayer{}
+	for _, s := range []string{"bpp=2", "compression.map=lz2", "compression.pixels=lz77", "outputs=[json]"} {
+		layer, err := ParseOptionOverride(s)
+		assert.NoError(t, err)
+		overrides = append(overrides, layer)
+	}
+	overrides = append(overrides, OptionLayer{Source: configPath})
+
+	// Overrides win over the pmage file, and later overrides win over earlier ones.
+	var pf PmageFile
+	assert.NoError(t, pf.LoadYamlFileWithLayers(profile, nil, yamlPath, overrides))
+	assert.EqualValues(t, 2, pf.Bpp)
+	assert.EqualValues(t, 16, pf.TileWidth)
+	assert.Equal(t, PixelCompressionLz77, pf.Compression)
+	assert.Equal(t, PixelCompressionLz2, pf.MapCompression)
+	assert.Equal(t, "CONFIG", pf.Segment)
+	assert.Equal(t, "font", pf.Name)
+	assert.Equal(t, []Output{{Type: "json"}}, pf.Outputs)
+	assert.Equal(t, []string{yamlPath, configPath}, pf.Files)
+
+	// The pmage file is optional with overrides.
+	pf = PmageFile{}
+	assert.NoError(t, pf.LoadYamlFileWithLayers(profile, nil, filepath.Join(dir, "other.yaml"), overrides[:1]))
+	assert.EqualValues(t, 2, pf.Bpp)
+
+	// Errors name the override.
+	layer, err := ParseOptionOverride("bpp=3")
+	assert.NoError(t, err)
+	pf = PmageFile{}
+	err = pf.LoadYamlFileWithLayers(profile, nil, yamlPath, []OptionLayer{layer})
+	assert.ErrorIs(t, err, ErrInvalidColors)
+	assert.EqualError(t, err, "--set bpp=3: bpp is invalid: 3")
+	layer, err = ParseOptionOverride("compression.pixel=lz77")
+	assert.NoError(t, err)
+	err = pf.LoadYamlFileWithLayers(profile, nil, yamlPath, []OptionLayer{layer})
+	assert.EqualError(t, err, `--set compression.pixel=lz77: unknown option "pixel", did you mean "pixels"?`)
+
+	for _, s := range []string{"bpp", "=2", "compression..map=lz2", "bpp=[2"} {
+		_, err = ParseOptionOverride(s)
+		assert.ErrorIs(t, err, ErrInvalidOverride, s)
+	}
+}
@@ -53,6 +53,10 @@ type Product struct {
 	PaletteFormat ColorFormat
 	Palette       []Color
 
+	// The source color of each palette entry in ColorFormat24bgr. When several source
+	// colors convert to the same entry, this is the first one found.
+	SourcePalette []Color
+
 	PixelFormat ColorFormat
 	Width       int
 	Height      int
@@ -63,7 +67,57 @@ type Product struct {
 
 	Map []TileIndex
 
+	// The number of tiles in each row of the source image.
+	TilesPerRow int
+
 	PixelPacking PixelPacking
+
+	// Compression results, so that exporting several formats doesn't compress the same
+	// data again.
+	compressed map[compressionKey]compressionResult
+}
+
+type compressionKey struct {
+	section   string
+	comp      PixelCompression
+	chunkSize int
+}
+
+type compressionResult struct {
+	chunks [][]byte
+	used   PixelCompression
+}
+
+// Returns the cached result for the key, or runs compress and caches the result.
+func (p *Product) cachedCompression(key compressionKey,
+	compress func() ([][]byte, PixelCompression, error)) ([][]byte, PixelCompression, error) {
+
+	if result, ok := p.compressed[key]; ok {
+		return result.chunks, result.used, nil
+	}
+
+	chunks, used, err := compress()
+	if err != nil {
+		return nil, PixelCompressionNone, err
+	}
+	if p.compressed == nil {
+		p.compressed = make(map[compressionKey]compressionResult)
+	}
+	p.compressed[key] = compressionResult{chunks, used}
+	return chunks, used, nil
+}
+
+// Compresses a single block of data through the cache.
+func (p *Product) cachedSingleCompression(section string, data []byte, comp PixelCompression) ([]byte, PixelCompression, error) {
+	chunks, used, err := p.cachedCompression(compressionKey{section: section, comp: comp},
+		func() ([][]byte, PixelCompression, error) {
+			compressed, used, err := applyCompression(data, comp)
+			return [][]byte{compressed}, used, err
+		})
+	if err != nil {
+		return nil, PixelCompressionNone, err
+	}
+	return chunks[0], used, nil
 }
 
 var ErrInvalidImage = errors.New("invalid image")
@@ -100,6 +154,7 @@ func (p *Product) LoadImage(img image.Image) error {
 		}
 	}
 	p.PixelFormat = ColorFormat32abgr
+	sourcePixels := slices.Clone(p.Pixels)
 
 	if err := p.convertPixels(); err != nil {
 		return err
@@ -115,6 +170,11 @@ func (p *Product) LoadImage(img image.Image) error {
 		if err := p.indexPixels(); err != nil {
 			return err
 		}
+		p.findSourcePalette(sourcePixels)
+	}
+
+	if err := p.checkSnesTiles(); err != nil {
+		return err
 	}
 
 	// if err := p.mapTiles(); err != nil {
@@ -207,6 +267,34 @@ func convertColors[T Color | Pixel](colors []T, to ColorFormat) error {
 	return nil
 }
 
+// Records the source color for each palette entry, from the fixed palette entries and
+// then the image.
+func (p *Product) findSourcePalette(sourcePixels []Pixel) {
+	p.SourcePalette = make([]Color, len(p.Palette))
+	found := make([]bool, len(p.Palette))
+	mapping := make(map[Color]int)
+	for i := len(p.Palette) - 1; i >= 0; i-- {
+		mapping[p.Palette[i]] = i
+	}
+
+	sources := []Color{}
+	for _, color := range p.Pmf.Palette {
+		sources = append(sources, color&0xFFFFFF)
+	}
+	for _, pixel := range sourcePixels {
+		sources = append(sources, Color(pixel)&0xFFFFFF)
+	}
+
+	for _, source := range sources {
+		converted := []Color{source}
+		convertColors(converted, p.PaletteFormat)
+		if index, ok := mapping[converted[0]]; ok && !found[index] {
+			p.SourcePalette[index] = source
+			found[index] = true
+		}
+	}
+}
+
 // Convert the default 32bgra pixels to the color format of the current profile.
 func (p *Product) convertPixels() error {
 	if p.PixelFormat != ColorFormat32abgr {
@@ -255,6 +343,7 @@ func (p *Product) tilePixels() error {
 	p.Pixels = newPixels
 	p.Width = twidth
 	p.Height = theight * htiles * vtiles
+	p.TilesPerRow = htiles
 
 	return nil
 }
@@ -282,17 +371,26 @@ func (p *Product) indexPixels() error {
 		p.Pixels[i] = Pixel(paletteIndex)
 	}
 
-	if p.Pmf.Bpp == 2 {
-		p.PixelFormat = ColorFormatIndexed2
-	} else if p.Pmf.Bpp == 4 {
-		p.PixelFormat = ColorFormatIndexed4
-	} else {
-		p.PixelFormat = ColorFormatIndexed8
-	}
+	p.PixelFormat = indexedFormat(p.Pmf.Bpp)
 
 	return nil
 }
 
+// The indexed pixel format with the given bits per pixel.
+func indexedFormat(bpp int16) ColorFormat {
+	switch bpp {
+	case 1:
+		return ColorFormatIndexed1
+	case 2:
+		return ColorFormatIndexed2
+	case 4:
+		return ColorFormatIndexed4
+	case 8:
+		return ColorFormatIndexed8
+	}
+	return ColorFormatInherit
+}
+
 // Creates a tilemap and eliminates duplicate tiles in the image.
 func (p *Product) mapTiles() error {
 	if p.Width != int(p.Pmf.TileWidth) {
@@ -388,70 +486,267 @@ func (p *Product) NumTiles() int {
 	return len(p.Pixels) / int(p.Pmf.TileWidth*p.Pmf.TileHeight)
 }
 
-// Convert the pixel data to a byte array.
+// The pixel packing, or the profile's if it isn't set.
+func (p *Product) pixelPacking() PixelPacking {
+	if p.PixelPacking == PixelPackingDefault {
+		return p.Profile.DefaultPixelPacking()
+	}
+	return p.PixelPacking
+}
+
+// Convert the pixel data to a byte array, without compression.
 func (p *Product) PixelBytes() []byte {
+	packing := p.pixelPacking()
+	pixels := p.Pixels
+	if isSnesPlanar(p.PixelFormat, packing) {
+		// The tiles are stacked in a column p.Width pixels wide.
+		pixels = splitSnesTiles(pixels, p.Width)
+	}
+	return packPixels(pixels, p.PixelFormat, packing)
+}
+
+// SNES bitplanes are stored as 8x8 tiles, so the tiles must be a multiple of 8 pixels
+// in each direction. Without tiling, the same goes for the image.
+func (p *Product) checkSnesTiles() error {
+	if !isSnesPlanar(p.PixelFormat, p.pixelPacking()) {
+		return nil
+	}
+	height := p.Height
+	if p.TilesPerRow > 0 {
+		height = int(p.Pmf.TileHeight)
+	}
+	if p.Width%8 != 0 || height%8 != 0 {
+		return fmt.Errorf("%w: SNES bitplanes need a multiple of 8x8 pixels, got %dx%d",
+			ErrInvalidTileSize, p.Width, height)
+	}
+	return nil
+}
+
+// Whether pixels of the format are packed into SNES bitplanes.
+func isSnesPlanar(format ColorFormat, packing PixelPacking) bool {
+	return packing == PixelPackingSnes && (format == ColorFormatIndexed2 ||
+		format == ColorFormatIndexed4 || format == ColorFormatIndexed8)
+}
+
+// Reorders pixels in rows of the given width into 8x8 tiles, left to right and top to
+// bottom, e.g. a 16x16 tile becomes its top left, top right, bottom left and bottom
+// right quarters. The last row of tiles may be shorter than 8 pixels.
+func splitSnesTiles(pixels []Pixel, width int) []Pixel {
+	if width <= 8 {
+		return pixels
+	}
+	rows := len(pixels) / width
+	tiles := make([]Pixel, 0, rows*width)
+	for y := 0; y < rows; y += 8 {
+		for x := 0; x < width; x += 8 {
+			for row := y; row < min(y+8, rows); row++ {
+				tiles = append(tiles, pixels[row*width+x:row*width+x+8]...)
+			}
+		}
+	}
+	return tiles
+}
 
-	packing := p.PixelPacking
-	if packing == PixelPackingDefault {
-		packing = p.Profile.DefaultPixelPacking()
+// Reverses splitSnesTiles. Pixels after the last whole row of tiles are dropped.
+func joinSnesTiles(tiles []Pixel, width int) []Pixel {
+	if width <= 8 {
+		return tiles
 	}
+	rows := len(tiles) / (width * 8) * 8
+	pixels := make([]Pixel, rows*width)
+	i := 0
+	for y := 0; y < rows; y += 8 {
+		for x := 0; x < width; x += 8 {
+			for row := y; row < y+8; row++ {
+				copy(pixels[row*width+x:row*width+x+8], tiles[i:i+8])
+				i += 8
+			}
+		}
+	}
+	return pixels
+}
 
+func packPixels(pixels []Pixel, format ColorFormat, packing PixelPacking) []byte {
 	var data []byte
 
 	// Convert to byte array.
-	switch p.PixelFormat {
+	switch format {
 	case ColorFormat15bgr:
 		// 2 bytes per pixel
-		data = make([]byte, len(p.Pixels)*2)
-		for i, pixel := range p.Pixels {
+		data = make([]byte, len(pixels)*2)
+		for i, pixel := range pixels {
 			data[i*2] = byte(pixel)
 			data[i*2+1] = byte(pixel >> 8)
 		}
 	case ColorFormatIndexed8:
-		// 1 byte per pixel
-		data = make([]byte, len(p.Pixels))
-		for i, pixel := range p.Pixels {
-			data[i] = byte(pixel)
+		if packing == PixelPackingSnes {
+			data = packSnesPlanes(pixels, 8)
+		} else {
+			// 1 byte per pixel
+			data = make([]byte, len(pixels))
+			for i, pixel := range pixels {
+				data[i] = byte(pixel)
+			}
 		}
 	case ColorFormatIndexed4:
-		// 1 byte per 2 pixels
-		data = make([]byte, len(p.Pixels)/2)
-		for i := 0; i < len(p.Pixels); i += 2 {
-			data[i/2] = byte(p.Pixels[i]) | byte(p.Pixels[i+1]<<4)
+		if packing == PixelPackingSnes {
+			data = packSnesPlanes(pixels, 4)
+		} else {
+			// 1 byte per 2 pixels
+			data = make([]byte, len(pixels)/2)
+			for i := 0; i < len(pixels); i += 2 {
+				data[i/2] = byte(pixels[i]) | byte(pixels[i+1]<<4)
+			}
 		}
 	case ColorFormatIndexed2:
-
 		if packing == PixelPackingSnes {
-			// Separated planes
-			// Plane 0 stored in bytes 00h,02h,04h,06h,08h,0Ah,0Ch,0Eh
-			// Plane 1 stored in bytes 01h,03h,05h,07h,09h,0Bh,0Dh,0Fh
-			data = make([]byte, len(p.Pixels))
-			for i := 0; i < len(p.Pixels); i += 8 {
-				a, b := byte(0), byte(0)
-				for bit := 0; bit < 7; bit++ {
-					a |= byte((p.Pixels[i+bit] & 1) << (7 - bit))
-					b |= byte(((p.Pixels[i+bit] >> 1) & 1) << (7 - bit))
-				}
-				data[i/4] = a
-				data[i/4+1] = b
-			}
+			data = packSnesPlanes(pixels, 2)
 		} else {
 			// 1 byte per 4 pixels
-			data = make([]byte, len(p.Pixels)/4)
-			for i := 0; i < len(p.Pixels); i += 4 {
-				data[i/4] = byte(p.Pixels[i]) |
-					byte(p.Pixels[i+1]<<2) |
-					byte(p.Pixels[i+2]<<4) |
-					byte(p.Pixels[i+3]<<6)
+			data = make([]byte, len(pixels)/4)
+			for i := 0; i < len(pixels); i += 4 {
+				data[i/4] = byte(pixels[i]) |
+					byte(pixels[i+1]<<2) |
+					byte(pixels[i+2]<<4) |
+					byte(pixels[i+3]<<6)
 			}
 		}
 	default:
 		panic("unimplemented pixel data format")
 	}
 
-	return applyCompression(data, p.Pmf.Compression)
+	return data
+}
+
+// Packs 8x8 tiles into SNES bitplanes; larger tiles are split with splitSnesTiles first.
+// Each row of 8 pixels is stored as one byte per plane, and the planes are stored in
+// pairs, interleaved by row, for each tile:
+//
+//	2bpp: planes 0/1 in bytes 00h-0Fh
+//	4bpp: planes 0/1 in bytes 00h-0Fh, planes 2/3 in bytes 10h-1Fh
+//	8bpp: planes 0/1, 2/3, 4/5 and 6/7 in 10h bytes each
+//
+// The last tile may have fewer than 8 rows.
+func packSnesPlanes(pixels []Pixel, bpp int) []byte {
+	rows := len(pixels) / 8
+	data := make([]byte, rows*bpp)
+	for tile := 0; tile < rows; tile += 8 {
+		tileRows := min(8, rows-tile)
+		for row := 0; row < tileRows; row++ {
+			rowPixels := pixels[(tile+row)*8 : (tile+row)*8+8]
+			for plane := 0; plane < bpp; plane++ {
+				b := byte(0)
+				for bit, pixel := range rowPixels {
+					b |= byte((pixel>>plane)&1) << (7 - bit)
+				}
+				data[tile*bpp+plane/2*tileRows*2+row*2+plane%2] = b
+			}
+		}
+	}
+	return data
+}
+
+// Reverses packSnesPlanes.
+func unpackSnesPlanes(data []byte, bpp int) []Pixel {
+	rows := len(data) / bpp
+	pixels := make([]Pixel, rows*8)
+	for tile := 0; tile < rows; tile += 8 {
+		tileRows := min(8, rows-tile)
+		for row := 0; row < tileRows; row++ {
+			rowPixels := pixels[(tile+row)*8 : (tile+row)*8+8]
+			for plane := 0; plane < bpp; plane++ {
+				b := data[tile*bpp+plane/2*tileRows*2+row*2+plane%2]
+				for bit := range rowPixels {
+					rowPixels[bit] |= Pixel((b>>(7-bit))&1) << plane
+				}
+			}
+		}
+	}
+	return pixels
+}
+
+// Reverses packPixels. Trailing bytes that don't make a whole pixel, or a whole row of
+// pixels for SNES planes, are ignored.
+func UnpackPixels(data []byte, format ColorFormat, packing PixelPacking) ([]Pixel, error) {
+	var pixels []Pixel
+
+	switch format {
+	case ColorFormat15bgr:
+		pixels = make([]Pixel, len(data)/2)
+		for i := range pixels {
+			pixels[i] = Pixel(data[i*2]) | Pixel(data[i*2+1])<<8
+		}
+	case ColorFormatIndexed8:
+		if packing == PixelPackingSnes {
+			pixels = unpackSnesPlanes(data, 8)
+		} else {
+			pixels = make([]Pixel, len(data))
+			for i, b := range data {
+				pixels[i] = Pixel(b)
+			}
+		}
+	case ColorFormatIndexed4:
+		if packing == PixelPackingSnes {
+			pixels = unpackSnesPlanes(data, 4)
+		} else {
+			pixels = make([]Pixel, len(data)*2)
+			for i, b := range data {
+				pixels[i*2] = Pixel(b & 0x0F)
+				pixels[i*2+1] = Pixel(b >> 4)
+			}
+		}
+	case ColorFormatIndexed2:
+		if packing == PixelPackingSnes {
+			pixels = unpackSnesPlanes(data, 2)
+		} else {
+			pixels = make([]Pixel, len(data)*4)
+			for i, b := range data {
+				for j := 0; j < 4; j++ {
+					pixels[i*4+j] = Pixel(b>>(j*2)) & 3
+				}
+			}
+		}
+	default:
+		return nil, fmt.Errorf("%w: unsupported pixel format", ErrUnsupported)
+	}
+
+	return pixels, nil
+}
+
+// Returns the pixel data compressed with the pmage file's compression setting, and the
+// compression that was used. The latter is only different when the setting is "auto".
+func (p *Product) CompressedPixelBytes() ([]byte, PixelCompression, error) {
+	return p.cachedSingleCompression("pixels", p.PixelBytes(), p.Pmf.Compression)
+}
+
+// Splits the pixel data into chunks of the pmage file's chunk size and compresses each one
+// separately, so they can be decompressed independently. Returns a single chunk if
+// chunking is disabled.
+func (p *Product) CompressedPixelChunks() ([][]byte, PixelCompression, error) {
+	data := p.PixelBytes()
+	chunkSize := p.Pmf.ChunkSize
+	if chunkSize == ChunkSizeRow {
+		if p.TilesPerRow == 0 {
+			return nil, PixelCompressionNone, fmt.Errorf("%w: row chunks require tiles", ErrConversion)
+		}
+		chunkSize = len(data) / p.NumTiles() * p.TilesPerRow
+	}
+	if chunkSize <= 0 {
+		chunkSize = max(len(data), 1)
+	}
+
+	chunks := [][]byte{}
+	for i := 0; i < len(data); i += chunkSize {
+		chunks = append(chunks, data[i:min(i+chunkSize, len(data))])
+	}
+
+	key := compressionKey{section: "pixels", comp: p.Pmf.Compression, chunkSize: chunkSize}
+	return p.cachedCompression(key, func() ([][]byte, PixelCompression, error) {
+		return applyChunkedCompression(chunks, p.Pmf.Compression)
+	})
 }
 
+// Convert the palette to a byte array, without compression.
 func (p *Product) PaletteBytes() []byte {
 
 	// Convert to byte array.
@@ -468,3 +763,50 @@ func (p *Product) PaletteBytes() []byte {
 
 	panic("unimplemented palette data format")
 }
+
+// Reverses PaletteBytes. A trailing odd byte is ignored.
+func UnpackPalette(data []byte, format ColorFormat) ([]Color, error) {
+	switch format {
+	case ColorFormat15bgr:
+		palette := make([]Color, len(data)/2)
+		for i := range palette {
+			palette[i] = (Color(data[i*2]) | Color(data[i*2+1])<<8) & 0x7FFF
+		}
+		return palette, nil
+	}
+
+	return nil, fmt.Errorf("%w: unsupported palette format", ErrUnsupported)
+}
+
+// Returns the palette data compressed with the pmage file's palette compression setting,
+// and the compression that was used.
+func (p *Product) CompressedPaletteBytes() ([]byte, PixelCompression, error) {
+	return p.cachedSingleCompression("palette", p.PaletteBytes(), p.Pmf.PaletteCompression)
+}
+
+// Convert the tilemap to a byte array, without compression. Entries are 16-bit, in the
+// SNES BG map format (vhopppcc cccccccc).
+func (p *Product) MapBytes() []byte {
+	data := make([]byte, len(p.Map)*2)
+	for i, entry := range p.Map {
+		value := uint16(entry.Index & 0x3FF)
+		if entry.Flags&MapFlagPrio != 0 {
+			value |= 0x2000
+		}
+		if entry.Flags&MapFlagHflip != 0 {
+			value |= 0x4000
+		}
+		if entry.Flags&MapFlagVflip != 0 {
+			value |= 0x8000
+		}
+		data[i*2] = byte(value)
+		data[i*2+1] = byte(value >> 8)
+	}
+	return data
+}
+
+// Returns the tilemap data compressed with the pmage file's map compression setting, and
+// the compression that was used.
+func (p *Product) CompressedMapBytes() ([]byte, PixelCompression, error) {
+	return p.cachedSingleCompression("map", p.MapBytes(), p.Pmf.MapCompression)
+}
@@ -31,10 +31,10 @@ colors: 4
 transparent: "ffffff"
 compression: none
 `
-	pmf, err := CreatePmageFileFromYamlString(&Profile{"snes"}, pmage, "test.yaml")
+	pmf, err := CreatePmageFileFromYamlString(&Profile{System: "snes"}, pmage, "test.yaml")
 	assert.NoError(t, err)
 
-	p := CreateProduct(&Profile{"snes"}, pmf)
+	p := CreateProduct(&Profile{System: "snes"}, pmf)
 	err = p.LoadImage(loadPng("test/gfx_ifont.png"))
 	assert.NoError(t, err)
 
@@ -54,7 +54,7 @@ compression: none
 // bpp: 4
 // `
 
-// 	profile := Profile{"snes"}
+// 	profile := Profile{System: "snes"}
 // 	pmf, err := CreatePmageFileFromYamlString(&profile, pmage)
 // 	assert.NoError(t, err)
 
@@ -65,3 +65,127 @@ compression: none
 // 	assert.Equal(t, 1, p.NumTiles())
 
 // }
+
+func TestMapBytes(t *testing.T) {
+	pmf, err := CreatePmageFileFromYamlString(&Profile{System: "snes"}, "compression: {map: lz2}", "test.yaml")
+	assert.NoError(t, err)
+
+	p := CreateProduct(&Profile{System: "snes"}, pmf)
+	p.Map = []TileIndex{
+		{Index: 1},
+		{Index: 0x3FF, Flags: MapFlagHflip},
+		{Index: 2, Flags: MapFlagVflip | MapFlagPrio},
+	}
+	assert.Equal(t, []byte{0x01, 0x00, 0xFF, 0x43, 0x02, 0xA0}, p.MapBytes())
+
+	compressed, compression, err := p.CompressedMapBytes()
+	assert.NoError(t, err)
+	assert.Equal(t, PixelCompressionLz2, compression)
+	decompressed, err := Decompress(compressed, compression)
+	assert.NoError(t, err)
+	assert.Equal(t, p.MapBytes(), decompressed)
+}
+
+func TestPixelBytes(t *testing.T) {
+	pmf, err := CreatePmageFileFromYamlString(&Profile{System: "snes"}, "bpp: 2", "test.yaml")
+	assert.NoError(t, err)
+
+	// SNES 2bpp rows are one byte of each plane, with the leftmost pixel in the top bit.
+	p := CreateProduct(&Profile{System: "snes"}, pmf)
+	p.PixelFormat = ColorFormatIndexed2
+	p.Pixels = []Pixel{1, 0, 0, 0, 0, 0, 0, 3, 2, 2, 0, 0, 0, 0, 0, 1}
+	assert.Equal(t, []byte{0x81, 0x01, 0x01, 0xC0}, p.PixelBytes())
+
+	// Larger tiles are split into 8x8 tiles for the PPU, in rows.
+	p.PixelFormat = ColorFormatIndexed4
+	p.Width = 16
+	p.Pixels = make([]Pixel, 16*16)
+	p.Pixels[8] = 1        // Top right
+	p.Pixels[8*16] = 2     // Bottom left
+	p.Pixels[15*16+15] = 5 // Bottom right
+	expected := make([]byte, 128)
+	expected[32] = 0x80
+	expected[64+1] = 0x80
+	expected[96+14], expected[96+30] = 0x01, 0x01
+	assert.Equal(t, expected, p.PixelBytes())
+
+	// So a 16x16 tile is the same as four 8x8 tiles.
+	small := loadTestFontProduct(t, "colors: 16\ntiles: 8x8")
+	large := loadTestFontProduct(t, "colors: 16\ntiles: 16x16")
+	smallBytes, largeBytes := small.PixelBytes(), large.PixelBytes()
+	assert.Equal(t, smallBytes[0:64], largeBytes[0:64])
+	assert.Equal(t, smallBytes[small.TilesPerRow*32:small.TilesPerRow*32+64], largeBytes[64:128])
+
+	// SNES bitplanes need tiles in multiples of 8 pixels.
+	pmf, err = CreatePmageFileFromYamlString(&Profile{System: "snes"}, "colors: 16\ntiles: 8x4", "test.yaml")
+	assert.NoError(t, err)
+	p = CreateProduct(&Profile{System: "snes"}, pmf)
+	assert.ErrorIs(t, p.LoadImage(loadPng("test/gfx_ifont.png")), ErrInvalidTileSize)
+}
+
+func TestCompressedPixelChunks(t *testing.T) {
+	pmage := `
+tiles: 8x8
+colors: 4
+compression: lz2
+chunk: row
+`
+	pmf, err := CreatePmageFileFromYamlString(&Profile{System: "snes"}, pmage, "test.yaml")
+	assert.NoError(t, err)
+	assert.Equal(t, ChunkSizeRow, pmf.ChunkSize)
+
+	p := CreateProduct(&Profile{System: "snes"}, pmf)
+	assert.NoError(t, p.LoadImage(loadPng("test/gfx_ifont.png")))
+
+	raw := p.PixelBytes()
+	rowSize := len(raw) / p.NumTiles() * p.TilesPerRow
+
+	chunks, compression, err := p.CompressedPixelChunks()
+	assert.NoError(t, err)
+	assert.Equal(t, PixelCompressionLz2, compression)
+	assert.Len(t, chunks, len(raw)/rowSize)
+
+	for i, chunk := range chunks {
+		decompressed, err := Decompress(chunk, compression)
+		assert.NoError(t, err)
+		assert.Equal(t, raw[i*rowSize:(i+1)*rowSize], decompressed)
+	}
+
+	// Fixed size chunks, with a smaller chunk at the end.
+	pmf.ChunkSize = 1000
+	chunks, _, err = p.CompressedPixelChunks()
+	assert.NoError(t, err)
+	assert.Len(t, chunks, (len(raw)+999)/1000)
+
+	for chunk, size := range map[string]int{"512": 512, "2KB": 2048, "1k": 1024, "4 KB": 4096} {
+		pmf, err := CreatePmageFileFromYamlString(&Profile{System: "snes"}, "chunk: "+chunk, "test.yaml")
+		assert.NoError(t, err)
+		assert.Equal(t, size, pmf.ChunkSize, chunk)
+	}
+
+	_, err = CreatePmageFileFromYamlString(&Profile{System: "snes"}, "chunk: half", "test.yaml")
+	assert.ErrorIs(t, err, ErrInvalidChunkSize)
+	_, err = CreatePmageFileFromYamlString(&Profile{System: "snes"}, "chunk: KB", "test.yaml")
+	assert.ErrorIs(t, err, ErrInvalidChunkSize)
+}
+
+func TestCompressionCache(t *testing.T) {
+	p := loadTestFontProduct(t, "compression: auto")
+
+	first, used, err := p.CompressedPixelBytes()
+	assert.NoError(t, err)
+	assert.Len(t, p.compressed, 1)
+
+	second, used2, err := p.CompressedPixelBytes()
+	assert.NoError(t, err)
+	assert.Equal(t, used, used2)
+	assert.Same(t, &first[0], &second[0])
+	assert.Len(t, p.compressed, 1)
+
+	// A different setting isn't served from the cache.
+	p.Pmf.Compression = PixelCompressionNone
+	third, _, err := p.CompressedPixelBytes()
+	assert.NoError(t, err)
+	assert.Equal(t, p.PixelBytes(), third)
+	assert.Len(t, p.compressed, 2)
+}
@@ -6,6 +6,9 @@ const SystemSnes = "snes"
 // command line.
 type Profile struct {
 	System string
+
+	// Project-wide symbol naming, which pmage files can override.
+	Labels LabelOptions
 }
 
 func (p *Profile) IsValidBpp(bpp int16) bool {
@@ -37,6 +40,15 @@ func (p *Profile) DefaultSegment() string {
 	return "GRAPHICS"
 }
 
+// The size of a ROM bank, for splitting large data across segments.
+func (p *Profile) DefaultBankSize() int {
+	if p.System == SystemSnes {
+		// LoROM
+		return 0x8000
+	}
+	panic("unknown system")
+}
+
 func (p *Profile) DefaultPixelPacking() PixelPacking {
 	if p.System == SystemSnes {
 		return PixelPackingSnes
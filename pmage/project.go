@@ -0,0 +1,330 @@
+package pmage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// A project file lists groups of images to convert, so the whole project can be built
+// with one command. Options shared by every image go at the top level, next to the
+// project settings, and each group can override them for its own images. For example:
+//
+//	profile: snes
+//	out: build/gfx
+//	export_types: ca65
+//	compression: lz77
+//	groups:
+//	  - inputs: [gfx/sprites]
+//	    segment: SPRITES
+//	    assets:
+//	      gfx/sprites/hero.png: {compression: none}
+//	  - inputs: gfx/fonts/*.png
+//	    out: build/fonts
+//	    export_types: [c, json]
+//
+// Any pmage file option can be used at the top level, in a group, or for an asset. An
+// image's own pmage file is optional, and it overrides all of them. The profile applies
+// to the whole project, so it's only allowed at the top level. Paths in the project file
+// are relative to it, except for output paths, which are relative to the image.
+//
+// The project file is a dependency of every job, so changing it rebuilds the images.
+type Project struct {
+	Path string
+
+	Profile     string // The system, or empty if it's not given.
+	OutDir      string // Where outputs are written. If empty, they go next to the images.
+	ExportTypes []string
+	Options     *yaml.Node // Pmage file options for every image. Nil if there are none.
+	Groups      []ProjectGroup
+}
+
+type ProjectGroup struct {
+	Inputs      []string // Same as for FindJobs.
+	OutDir      string   // Overrides the project's.
+	ExportTypes []string // Overrides the project's.
+	Options     *yaml.Node
+
+	// Options for single images, by path.
+	Assets map[string]ProjectAsset
+}
+
+type ProjectAsset struct {
+	ExportTypes []string
+	Options     *yaml.Node
+}
+
+const DefaultProjectFile = "pmage.yaml"
+
+var ErrInvalidProject = errors.New("invalid project file")
+
+// A list that can also be given as a comma separated string, e.g. `export_types: ca65,json`.
+type stringListInput []string
+
+func (l *stringListInput) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		var s string
+		if err := value.Decode(&s); err != nil {
+			return err
+		}
+		*l = nil
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				*l = append(*l, item)
+			}
+		}
+		return nil
+	}
+	return value.Decode((*[]string)(l))
+}
+
+// Separates the project settings from the pmage file options in a mapping. The options
+// are nil if there aren't any.
+func splitProjectNode(node *yaml.Node, keys ...string) (map[string]*yaml.Node, *yaml.Node, error) {
+	if node.Kind != yaml.MappingNode {
+		return nil, nil, fmt.Errorf("%w: line %d: expected a mapping", ErrInvalidProject, node.Line)
+	}
+	settings := map[string]*yaml.Node{}
+	options := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: node.Line, Column: node.Column}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		if _, ok := settings[key.Value]; ok || hasOption(options, key.Value) {
+			return nil, nil, fmt.Errorf("%w: line %d: duplicate key \"%s\"", ErrInvalidProject, key.Line, key.Value)
+		}
+		isSetting := false
+		for _, k := range keys {
+			if key.Value == k {
+				isSetting = true
+			}
+		}
+		if isSetting {
+			settings[key.Value] = value
+		} else {
+			options.Content = append(options.Content, key, value)
+		}
+	}
+	if len(options.Content) == 0 {
+		options = nil
+	}
+	return settings, options, nil
+}
+
+func hasOption(options *yaml.Node, key string) bool {
+	for i := 0; i < len(options.Content); i += 2 {
+		if options.Content[i].Value == key {
+			return true
+		}
+	}
+	return false
+}
+
+// The profile is used by the converter for every image, so it can't change per group.
+func checkNoProfile(options *yaml.Node) error {
+	if options == nil {
+		return nil
+	}
+	for i := 0; i < len(options.Content); i += 2 {
+		if key := options.Content[i]; key.Value == "profile" {
+			return fmt.Errorf("%w: line %d: the profile can only be set at the top of the project",
+				ErrInvalidProject, key.Line)
+		}
+	}
+	return nil
+}
+
+func decodeProjectSetting(settings map[string]*yaml.Node, key string, out any) error {
+	node, ok := settings[key]
+	if !ok {
+		return nil
+	}
+	if err := node.Decode(out); err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrInvalidProject, key, err)
+	}
+	return nil
+}
+
+// Paths in the project file are relative to it.
+func (p *Project) resolvePath(path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(filepath.Dir(p.Path), path)
+}
+
+func LoadProject(path string) (*Project, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	project, err := parseProject(data, path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return project, nil
+}
+
+func parseProject(data []byte, path string) (*Project, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidProject, err)
+	}
+	if len(doc.Content) == 0 {
+		return nil, fmt.Errorf("%w: the project is empty", ErrInvalidProject)
+	}
+
+	p := &Project{Path: path}
+	settings, options, err := splitProjectNode(doc.Content[0], "profile", "out", "export_types", "groups")
+	if err != nil {
+		return nil, err
+	}
+	p.Options = options
+
+	var exportTypes stringListInput
+	var groups []yaml.Node
+	if err = errors.Join(
+		decodeProjectSetting(settings, "profile", &p.Profile),
+		decodeProjectSetting(settings, "out", &p.OutDir),
+		decodeProjectSetting(settings, "export_types", &exportTypes),
+		decodeProjectSetting(settings, "groups", &groups),
+	); err != nil {
+		return nil, err
+	}
+	p.OutDir = p.resolvePath(p.OutDir)
+	p.ExportTypes = exportTypes
+	if len(groups) == 0 {
+		return nil, fmt.Errorf("%w: no groups", ErrInvalidProject)
+	}
+
+	for i := range groups {
+		group, err := p.parseGroup(&groups[i])
+		if err != nil {
+			return nil, fmt.Errorf("group %d: %w", i+1, err)
+		}
+		p.Groups = append(p.Groups, group)
+	}
+	return p, nil
+}
+
+func (p *Project) parseGroup(node *yaml.Node) (ProjectGroup, error) {
+	group := ProjectGroup{Assets: map[string]ProjectAsset{}}
+	settings, options, err := splitProjectNode(node, "inputs", "out", "export_types", "assets")
+	if err != nil {
+		return group, err
+	}
+	if err = checkNoProfile(options); err != nil {
+		return group, err
+	}
+	group.Options = options
+
+	var inputs, exportTypes stringListInput
+	var assets map[string]yaml.Node
+	if err = errors.Join(
+		decodeProjectSetting(settings, "inputs", &inputs),
+		decodeProjectSetting(settings, "out", &group.OutDir),
+		decodeProjectSetting(settings, "export_types", &exportTypes),
+		decodeProjectSetting(settings, "assets", &assets),
+	); err != nil {
+		return group, err
+	}
+	if len(inputs) == 0 {
+		return group, fmt.Errorf("%w: no inputs", ErrInvalidProject)
+	}
+	for _, input := range inputs {
+		group.Inputs = append(group.Inputs, p.resolvePath(input))
+	}
+	group.OutDir = p.resolvePath(group.OutDir)
+	group.ExportTypes = exportTypes
+
+	for assetPath, assetNode := range assets {
+		asset := ProjectAsset{}
+		settings, options, err := splitProjectNode(&assetNode, "export_types")
+		if err == nil {
+			err = checkNoProfile(options)
+		}
+		if err != nil {
+			return group, fmt.Errorf("%s: %w", assetPath, err)
+		}
+		var exportTypes stringListInput
+		if err = decodeProjectSetting(settings, "export_types", &exportTypes); err != nil {
+			return group, fmt.Errorf("%s: %w", assetPath, err)
+		}
+		asset.ExportTypes = exportTypes
+		asset.Options = options
+		group.Assets[filepath.Clean(p.resolvePath(assetPath))] = asset
+	}
+	return group, nil
+}
+
+// Finds the images in each group and where their output goes, like FindJobs. Images in
+// a group don't need pmage files, but images written by another job are skipped. If
+// exportTypes is empty, the export types in the project are used.
+func (p *Project) Jobs(converter Converter, exportTypes []string) ([]ConvertJob, error) {
+	jobs := []ConvertJob{}
+	for i, group := range p.Groups {
+		images, err := findImages(group.Inputs, false)
+		if err != nil {
+			return nil, fmt.Errorf("%s: group %d: %w", p.Path, i+1, err)
+		}
+
+		outDir := p.OutDir
+		if group.OutDir != "" {
+			outDir = group.OutDir
+		}
+
+		found := map[string]bool{}
+		for _, image := range images {
+			asset := group.Assets[filepath.Clean(image.path)]
+			found[filepath.Clean(image.path)] = true
+
+			jobExportTypes := exportTypes
+			for _, types := range [][]string{asset.ExportTypes, group.ExportTypes, p.ExportTypes} {
+				if len(jobExportTypes) == 0 {
+					jobExportTypes = types
+				}
+			}
+			ext, err := outputExt(jobExportTypes)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", p.Path, err)
+			}
+
+			job := ConvertJob{
+				InputPath:   image.path,
+				OutputPath:  image.outputPath(outDir, ext),
+				ExportTypes: jobExportTypes,
+			}
+			// The project's own layer is always there, even if it's empty, so the images
+			// don't need pmage files and the project is one of their dependencies.
+			projectOptions := p.Options
+			if projectOptions == nil {
+				projectOptions = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			}
+			job.Layers = append(job.Layers, OptionLayer{Source: p.Path, Node: projectOptions})
+			for _, options := range []*yaml.Node{group.Options, asset.Options} {
+				if options != nil {
+					job.Layers = append(job.Layers, OptionLayer{Source: p.Path, Node: options})
+				}
+			}
+			jobs = append(jobs, job)
+		}
+
+		// Catch typos in the asset paths.
+		for assetPath := range group.Assets {
+			if !found[assetPath] {
+				return nil, fmt.Errorf("%s: %w: %s is not in group %d", p.Path, ErrInvalidProject, assetPath, i+1)
+			}
+		}
+	}
+
+	if len(jobs) == 0 {
+		return nil, fmt.Errorf("%w: no PNG files in %s", ErrNoInputs, p.Path)
+	}
+	jobs, files := removeOutputJobs(jobs, planJobs(converter, jobs))
+	if err := checkOutputPaths(jobs, files); err != nil {
+		return nil, fmt.Errorf("%s: %w: %w", p.Path, ErrInvalidProject, err)
+	}
+	return jobs, nil
+}
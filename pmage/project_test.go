@@ -0,0 +1,157 @@
+package pmage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testProject = `
+profile: snes
+out: build
+export_types: ca65
+colors: 4
+transparent: "0072BC"
+export: pixels palette
+groups:
+  - inputs: [sprites]
+    segment: SPRITES
+    compression: lz77
+    assets:
+      sprites/hero.png: {compression: none, name: player}
+  - inputs: fonts/*.png
+    out: build/fonts
+    export_types: c, json
+`
+
+func TestProject(t *testing.T) {
+	dir := t.TempDir()
+	copyTestFile(t, "test/gfx_ifont.png", filepath.Join(dir, "sprites", "hero.png"))
+	copyTestFile(t, "test/gfx_ifont.png", filepath.Join(dir, "sprites", "enemy.png"))
+	copyTestFile(t, "test/gfx_ifont.png", filepath.Join(dir, "fonts", "small.png"))
+	// The image's own pmage file overrides the project.
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "sprites", "enemy.yaml"), []byte("segment: ENEMIES"), 0644))
+	projectPath := filepath.Join(dir, DefaultProjectFile)
+	assert.NoError(t, os.WriteFile(projectPath, []byte(testProject), 0644))
+
+	project, err := LoadProject(projectPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "snes", project.Profile)
+	assert.Equal(t, filepath.Join(dir, "build"), project.OutDir)
+	assert.Len(t, project.Groups, 2)
+
+	converter := NewConverter(&Profile{System: SystemSnes})
+	jobs, err := project.Jobs(converter, nil)
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 3)
+	assert.Equal(t, filepath.Join(dir, "build", "enemy.asm"), jobs[0].OutputPath)
+	assert.Equal(t, filepath.Join(dir, "build", "hero.asm"), jobs[1].OutputPath)
+	assert.Len(t, jobs[1].Layers, 3)
+	assert.Equal(t, filepath.Join(dir, "build", "fonts", "small.c"), jobs[2].OutputPath)
+	assert.Equal(t, []string{"c", "json"}, jobs[2].ExportTypes)
+
+	results := RunJobs(converter, jobs, 2)
+	for _, result := range results {
+		assert.NoError(t, result.Err)
+		if result.Err == nil {
+			assert.Contains(t, result.Result.Dependencies, projectPath)
+		}
+	}
+
+	enemy, _ := os.ReadFile(jobs[0].OutputPath)
+	assert.Contains(t, string(enemy), `.segment "ENEMIES"`)
+	hero, _ := os.ReadFile(jobs[1].OutputPath)
+	assert.Contains(t, string(hero), `.segment "SPRITES"`)
+	assert.Contains(t, string(hero), "player_pixels:")
+	assert.FileExists(t, filepath.Join(dir, "build", "fonts", "small.json"))
+
+	// The project is a dependency even without options for the image.
+	assert.NoError(t, os.WriteFile(projectPath, []byte("out: build\ngroups:\n  - inputs: fonts"), 0644))
+	project, err = LoadProject(projectPath)
+	assert.NoError(t, err)
+	jobs, err = project.Jobs(converter, nil)
+	assert.NoError(t, err)
+	assert.Len(t, jobs[0].Layers, 1)
+	result, err := converter.Convert(jobs[0])
+	assert.NoError(t, err)
+	assert.Contains(t, result.Dependencies, projectPath)
+	assert.NoError(t, os.WriteFile(projectPath, []byte(testProject), 0644))
+	project, err = LoadProject(projectPath)
+	assert.NoError(t, err)
+
+	// Export types from the command line override the project.
+	jobs, err = project.Jobs(converter, []string{"bin"})
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "build", "fonts", "small.bin"), jobs[2].OutputPath)
+}
+
+func TestProjectSkipsOutputs(t *testing.T) {
+	dir := t.TempDir()
+	copyTestFile(t, "test/gfx_ifont.png", filepath.Join(dir, "fonts", "small.png"))
+	projectPath := filepath.Join(dir, DefaultProjectFile)
+	assert.NoError(t, os.WriteFile(projectPath,
+		[]byte("colors: 4\ngroups:\n  - inputs: fonts\n    export_types: [ca65, preview]"), 0644))
+	project, err := LoadProject(projectPath)
+	assert.NoError(t, err)
+
+	// Without "out", the preview is written next to the image.
+	converter := NewConverter(&Profile{System: SystemSnes})
+	for run := 0; run < 2; run++ {
+		jobs, err := project.Jobs(converter, nil)
+		assert.NoError(t, err)
+		assert.Len(t, jobs, 1, "run %d", run)
+		for _, result := range RunJobs(converter, jobs, 1) {
+			assert.NoError(t, result.Err)
+		}
+	}
+	assert.FileExists(t, filepath.Join(dir, "fonts", "small.preview.png"))
+	assert.NoFileExists(t, filepath.Join(dir, "fonts", "small.preview.asm"))
+}
+
+func TestProjectErrors(t *testing.T) {
+	dir := t.TempDir()
+	copyTestFile(t, "test/gfx_ifont.png", filepath.Join(dir, "sprites", "hero.png"))
+
+	load := func(content string) (*Project, error) {
+		path := filepath.Join(dir, DefaultProjectFile)
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+		return LoadProject(path)
+	}
+
+	converter := NewConverter(&Profile{System: SystemSnes})
+	_, err := load("out: build")
+	assert.ErrorIs(t, err, ErrInvalidProject)
+	_, err = load("groups:\n  - out: build")
+	assert.ErrorIs(t, err, ErrInvalidProject)
+	_, err = load("groups:\n  - inputs: sprites\n    bpp: 2\n    bpp: 4")
+	assert.ErrorIs(t, err, ErrInvalidProject)
+	_, err = load("groups:\n  - inputs: sprites\n    profile: snes")
+	assert.ErrorIs(t, err, ErrInvalidProject)
+	assert.ErrorContains(t, err, "top of the project")
+	_, err = load("groups:\n  - inputs: sprites\n    assets:\n      sprites/hero.png: {profile: snes}")
+	assert.ErrorIs(t, err, ErrInvalidProject)
+
+	// Asset paths have to match an image in the group.
+	project, err := load("groups:\n  - inputs: sprites\n    assets:\n      sprites/heroo.png: {bpp: 2}")
+	assert.NoError(t, err)
+	_, err = project.Jobs(converter, nil)
+	assert.ErrorIs(t, err, ErrInvalidProject)
+
+	// Two images can't write the same output.
+	project, err = load("out: build\ngroups:\n  - inputs: sprites\n  - inputs: sprites/*.png")
+	assert.NoError(t, err)
+	_, err = project.Jobs(converter, nil)
+	assert.ErrorIs(t, err, ErrInvalidProject)
+	assert.ErrorIs(t, err, ErrInvalidOutput)
+
+	// Or the same include.
+	copyTestFile(t, "test/gfx_ifont.png", filepath.Join(dir, "fonts", "small.png"))
+	project, err = load("out: build\ngroups:\n  - inputs: sprites\n" +
+		"  - inputs: fonts\n    outputs: [{type: bin, path: ../build/hero.inc}]")
+	assert.NoError(t, err)
+	_, err = project.Jobs(converter, nil)
+	assert.ErrorIs(t, err, ErrInvalidOutput)
+	assert.ErrorContains(t, err, filepath.Join(dir, "build", "hero.inc"))
+}
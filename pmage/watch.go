@@ -0,0 +1,192 @@
+package pmage
+
+import (
+	"errors"
+	"os"
+	"slices"
+	"time"
+)
+
+// A watcher rebuilds images when they or their pmage files change. It polls the
+// modification times and sizes of each job's dependencies, so it works the same on every
+// platform and filesystem, including network shares where change notifications are
+// unreliable.
+type Watcher struct {
+	Inputs      []string // Same as for FindJobs.
+	OutDir      string
+	ExportTypes []string
+	Converter   Converter
+	Workers     int
+
+	// Finds the jobs on each poll instead of FindJobs, e.g. from a project file.
+	FindJobs func() ([]ConvertJob, error)
+
+	// Called with the result of each rebuild, in the order of the jobs.
+	OnResult func(JobResult)
+
+	// Called when finding the jobs fails after an earlier poll found them, e.g. because
+	// two images write the same file. The last jobs that were found are watched until it's
+	// fixed. Each error is only reported once.
+	OnError func(error)
+
+	// The dependencies of each job and their state when it was last converted.
+	jobs map[string]watchedJob
+
+	// The jobs from the last poll that found them, and the last error reported since.
+	lastJobs  []ConvertJob
+	lastError string
+	polled    bool
+}
+
+type watchedJob struct {
+	deps map[string]fileState
+
+	// Where the job wrote its outputs. A change, e.g. from a project file, rebuilds it.
+	outputPath  string
+	exportTypes []string
+}
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+	exists  bool
+}
+
+func statFile(path string) fileState {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileState{}
+	}
+	return fileState{info.ModTime(), info.Size(), true}
+}
+
+// The dependencies of a job that hasn't been converted.
+func (w *Watcher) defaultDeps(job ConvertJob) []string {
+	deps := []string{job.InputPath, changeExt(job.InputPath, ".yaml")}
+	for _, layer := range append(slices.Clip(job.Layers), job.Overrides...) {
+		if layer.Source != "" {
+			deps = append(deps, layer.Source)
+		}
+	}
+	if found, missing, err := findDefaultsFiles(changeExt(job.InputPath, ".yaml")); err == nil {
+		deps = append(append(deps, found...), missing...)
+	}
+	return deps
+}
+
+func (w *Watcher) isStale(job ConvertJob) bool {
+	watched, ok := w.jobs[job.InputPath]
+	if !ok || watched.outputPath != job.OutputPath || !slices.Equal(watched.exportTypes, job.ExportTypes) {
+		return true
+	}
+	for path, state := range watched.deps {
+		if statFile(path) != state {
+			return true
+		}
+	}
+	return false
+}
+
+// Scans the inputs once and rebuilds new images and the ones with changed
+// dependencies. Returns the results of the rebuilds.
+func (w *Watcher) Poll() ([]JobResult, error) {
+	if w.jobs == nil {
+		w.jobs = make(map[string]watchedJob)
+	}
+
+	var jobs []ConvertJob
+	var err error
+	if w.FindJobs != nil {
+		jobs, err = w.FindJobs()
+	} else {
+		jobs, err = FindJobs(w.Converter, w.Inputs, w.OutDir, w.ExportTypes)
+	}
+	if errors.Is(err, ErrNoInputs) {
+		// Wait for images to be added.
+		jobs, err = nil, nil
+	}
+	if err != nil && w.polled {
+		if err.Error() != w.lastError && w.OnError != nil {
+			w.OnError(err)
+		}
+		jobs, err, w.lastError = w.lastJobs, nil, err.Error()
+	} else if err != nil {
+		return nil, err
+	} else {
+		w.lastJobs, w.lastError, w.polled = jobs, "", true
+	}
+
+	// Forget removed images, so they're rebuilt if they come back.
+	found := map[string]bool{}
+	for _, job := range jobs {
+		found[job.InputPath] = true
+	}
+	for input := range w.jobs {
+		if !found[input] {
+			delete(w.jobs, input)
+		}
+	}
+
+	// The files are checked before converting, so changes made during the conversion
+	// trigger another one.
+	stale := []ConvertJob{}
+	before := map[string]fileState{}
+	for _, job := range jobs {
+		if !w.isStale(job) {
+			continue
+		}
+		stale = append(stale, job)
+		for _, dep := range w.defaultDeps(job) {
+			before[dep] = statFile(dep)
+		}
+		for dep := range w.jobs[job.InputPath].deps {
+			before[dep] = statFile(dep)
+		}
+	}
+
+	results := RunJobs(w.Converter, stale, w.Workers)
+	for _, result := range results {
+		// Failed jobs are watched too, so fixing the pmage file triggers a rebuild.
+		deps := w.defaultDeps(result.Job)
+		if result.Result != nil {
+			deps = append(slices.Clip(result.Result.Dependencies), result.Result.Missing...)
+		}
+
+		watched := watchedJob{
+			deps:        map[string]fileState{},
+			outputPath:  result.Job.OutputPath,
+			exportTypes: result.Job.ExportTypes,
+		}
+		for _, dep := range deps {
+			state, ok := before[dep]
+			if !ok {
+				state = statFile(dep)
+			}
+			watched.deps[dep] = state
+		}
+		w.jobs[result.Job.InputPath] = watched
+
+		if w.OnResult != nil {
+			w.OnResult(result)
+		}
+	}
+
+	return results, nil
+}
+
+// Polls the inputs at the given interval until stop is closed. Returns an error if the
+// first poll can't find the jobs.
+func (w *Watcher) Run(interval time.Duration, stop <-chan struct{}) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := w.Poll(); err != nil {
+			return err
+		}
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
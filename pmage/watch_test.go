@@ -0,0 +1,100 @@
+package pmage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatcherPoll(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	copyTestFile(t, "test/gfx_ifont.png", filepath.Join(src, "font.png"))
+	copyTestFile(t, "test/gfx_ifont.yaml", filepath.Join(src, "font.yaml"))
+	copyTestFile(t, "test/gfx_ifont.png", filepath.Join(src, "icons.png"))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "icons.yaml"), []byte("colors: 3"), 0644))
+
+	reported := []string{}
+	watcher := &Watcher{
+		Inputs:    []string{src},
+		OutDir:    filepath.Join(dir, "out"),
+		Converter: NewConverter(&Profile{System: SystemSnes}),
+		Workers:   2,
+		OnResult: func(result JobResult) {
+			reported = append(reported, filepath.Base(result.Job.InputPath))
+		},
+		OnError: func(err error) {
+			reported = append(reported, err.Error())
+		},
+	}
+
+	poll := func() []JobResult {
+		results, err := watcher.Poll()
+		assert.NoError(t, err)
+		return results
+	}
+
+	results := poll()
+	assert.Len(t, results, 2)
+	assert.NoError(t, results[0].Err)
+	assert.Error(t, results[1].Err)
+	assert.Equal(t, []string{"font.png", "icons.png"}, reported)
+
+	// Nothing changed.
+	assert.Empty(t, poll())
+
+	// Fixing the pmage file rebuilds only that image.
+	later := time.Now().Add(time.Second)
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "icons.yaml"), []byte("colors: 4"), 0644))
+	assert.NoError(t, os.Chtimes(filepath.Join(src, "icons.yaml"), later, later))
+	results = poll()
+	assert.Len(t, results, 1)
+	assert.Equal(t, filepath.Join(src, "icons.png"), results[0].Job.InputPath)
+	assert.NoError(t, results[0].Err)
+	assert.FileExists(t, filepath.Join(dir, "out", "icons.asm"))
+
+	// New images are picked up.
+	copyTestFile(t, "test/gfx_ifont.png", filepath.Join(src, "hud", "bar.png"))
+	copyTestFile(t, "test/gfx_ifont.yaml", filepath.Join(src, "hud", "bar.yaml"))
+	results = poll()
+	assert.Len(t, results, 1)
+	assert.FileExists(t, filepath.Join(dir, "out", "hud", "bar.asm"))
+
+	// Removed images are forgotten.
+	assert.NoError(t, os.Remove(filepath.Join(src, "hud", "bar.png")))
+	assert.Empty(t, poll())
+	assert.Len(t, watcher.jobs, 2)
+
+	// Images are rebuilt when their outputs move or change type, even if no file did.
+	watcher.OutDir = filepath.Join(dir, "out2")
+	assert.Len(t, poll(), 2)
+	assert.FileExists(t, filepath.Join(dir, "out2", "font.asm"))
+	watcher.ExportTypes = []string{"ca65", "json"}
+	assert.Len(t, poll(), 2)
+	assert.FileExists(t, filepath.Join(dir, "out2", "font.json"))
+	assert.Empty(t, poll())
+
+	// While two images write the same file, the last jobs are watched, and the error is
+	// reported once.
+	other := filepath.Join(dir, "other")
+	copyTestFile(t, "test/gfx_ifont.png", filepath.Join(other, "font.png"))
+	copyTestFile(t, "test/gfx_ifont.yaml", filepath.Join(other, "font.yaml"))
+	watcher.Inputs = []string{src, other}
+	reported = nil
+	assert.Empty(t, poll())
+	assert.Empty(t, poll())
+	if assert.Len(t, reported, 1) {
+		assert.Contains(t, reported[0], "are both written to")
+	}
+	assert.Len(t, watcher.jobs, 2)
+	assert.NoError(t, os.Remove(filepath.Join(other, "font.png")))
+	assert.Empty(t, poll())
+
+	// An error on the first poll stops the watch.
+	copyTestFile(t, "test/gfx_ifont.png", filepath.Join(other, "font.png"))
+	_, err := (&Watcher{Inputs: watcher.Inputs, OutDir: watcher.OutDir, Converter: watcher.Converter}).Poll()
+	assert.ErrorIs(t, err, ErrInvalidOutput)
+}